@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// lineChartLegend is the largest number of species listed in the legend of a line chart animation.
+const lineChartLegend = 10
+
+// SpeciesColor() takes a species, and returns its color in the line charts:
+// the color given by the user if there is one, otherwise the CategoryColor() of its index.
+func SpeciesColor(specie *Specie) color.Color {
+	if specie.color != nil {
+		return color.RGBA{R: specie.color[0], G: specie.color[1], B: specie.color[2], A: 255}
+	}
+	return CategoryColor(specie.index)
+}
+
+// ParsePhasePlane() takes two species indices separated by a comma, such as "0,1", and the number of species,
+// and returns the indices, or nil for an empty string.
+func ParsePhasePlane(text string, numSpecies int) []int {
+	if text == "" {
+		return nil
+	}
+
+	fields := strings.Split(text, ",")
+	if len(fields) != 2 {
+		panic("Error: the phase plane takes two species indices separated by a comma.")
+	}
+	indices := make([]int, 2)
+	for k, field := range fields {
+		index, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || index < 0 || index >= numSpecies {
+			panic("Error: invalid species index given for the phase plane: " + field)
+		}
+		indices[k] = index
+	}
+	return indices
+}
+
+// populationRange() takes time points and species indices, and returns the smallest and largest finite population
+// of these species, widened by 5% so that the curves do not touch the frame of a plot.
+func populationRange(timePoints []*Ecosystem, indices []int) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, ecosystem := range timePoints {
+		for _, i := range indices {
+			if p := ecosystem.species[i].population; finite(p) {
+				low, high = math.Min(low, p), math.Max(high, p)
+			}
+		}
+	}
+	if math.IsInf(low, 1) {
+		return 0, 1
+	}
+	if high-low == 0 {
+		high = low + 1
+	}
+	padding := 0.05 * (high - low)
+	return math.Max(0, low-padding), high + padding
+}
+
+// finite() returns true if none of the values is NaN or infinite, so that they can be plotted.
+func finite(values ...float64) bool {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// TracedPlot is a Plot whose curves are drawn once in full, remembering the time point at which every pixel was first
+// drawn, so that the plot as it was at any time point of an animation can be rendered on its own.
+type TracedPlot struct {
+	plot    *Plot
+	blank   *image.RGBA // the plot without curves
+	painted []int32     // time point at which every pixel was first drawn, or -1 if it never is
+}
+
+// NewTracedPlot() takes a Plot with its axes and legend but without curves, and returns a TracedPlot of it.
+func NewTracedPlot(plot *Plot) *TracedPlot {
+	blank := image.NewRGBA(plot.img.Bounds())
+	draw.Draw(blank, blank.Bounds(), plot.img, image.Point{}, draw.Src)
+
+	painted := make([]int32, len(blank.Pix)/4)
+	for k := range painted {
+		painted[k] = -1
+	}
+	return &TracedPlot{plot: plot, blank: blank, painted: painted}
+}
+
+// TraceLine() draws a line of a curve on a TracedPlot between two points in data coordinates, at time point k.
+func TraceLine(traced *TracedPlot, k int, x0, y0, x1, y1 float64, c color.Color) {
+	LinePixels(traced.plot, x0, y0, x1, y1, func(px, py int) {
+		traced.plot.img.Set(px, py, c)
+		if pixel := py*traced.blank.Bounds().Dx() + px; traced.painted[pixel] < 0 {
+			traced.painted[pixel] = int32(k)
+		}
+	})
+}
+
+// TracedImage() takes a TracedPlot and a time point, and returns a Plot with a new image of the curves drawn until
+// that time point. Pixels drawn over later keep their final color.
+func TracedImage(traced *TracedPlot, k int) *Plot {
+	frame := *traced.plot
+	frame.img = image.NewRGBA(traced.blank.Bounds())
+	copy(frame.img.Pix, traced.blank.Pix)
+	for pixel, when := range traced.painted {
+		if when >= 0 && int(when) <= k {
+			copy(frame.img.Pix[4*pixel:4*pixel+4], traced.plot.img.Pix[4*pixel:4*pixel+4])
+		}
+	}
+	return &frame
+}
+
+// DrawLineChartFrames() takes the time points of a run, the time between them, the frequency of the frames and two
+// species indices for a phase plane (nil for none), and returns the frames of LineChartRenderer() in memory.
+func DrawLineChartFrames(timePoints []*Ecosystem, time float64, frequency int, phase []int) []image.Image {
+	numFrames, render := LineChartRenderer(timePoints, time, frequency, phase)
+	return RenderFrames(numFrames, render)
+}
+
+// LineChartRenderer() takes the time points of a run, the time between them, the frequency of the frames and two
+// species indices for a phase plane (nil for none). It returns the number of frames of an animation tracing the
+// population curves over time, one every frequency time points like EcoBoardRenderer() plus the last time point,
+// and their FrameRenderer. The phase-plane trace of the two species is drawn next to the curves if they are given,
+// and the current populations are marked on every frame.
+func LineChartRenderer(timePoints []*Ecosystem, time float64, frequency int, phase []int) (int, FrameRenderer) {
+	species := timePoints[0].species
+	end := math.Max(time*float64(len(timePoints)-1), time)
+
+	all := make([]int, len(species))
+	for i := range all {
+		all[i] = i
+	}
+	low, high := populationRange(timePoints, all)
+
+	// the legend lists the first species, and counts the others on its last line
+	labels := make([]string, 0, lineChartLegend)
+	colors := make([]color.Color, 0, lineChartLegend)
+	for _, specie := range species {
+		if len(labels) == lineChartLegend-1 && len(species) > lineChartLegend {
+			labels = append(labels, fmt.Sprintf("and %d more species", len(species)-len(labels)))
+			colors = append(colors, color.Gray{Y: 200})
+			break
+		}
+		labels = append(labels, SpeciesName(specie))
+		colors = append(colors, SpeciesColor(specie))
+	}
+
+	linePlot := NewPlot(600, 300, 0, end, low, high, len(labels))
+	DrawAxes(linePlot, "Populations", "Time", "Population")
+	DrawPlotLegend(linePlot, labels, colors)
+	lines := NewTracedPlot(linePlot)
+
+	var phasePlane *TracedPlot
+	if phase != nil {
+		xLow, xHigh := populationRange(timePoints, phase[:1])
+		yLow, yHigh := populationRange(timePoints, phase[1:])
+		phasePlot := NewPlot(300, 300, xLow, xHigh, yLow, yHigh, len(labels))
+		DrawAxes(phasePlot, "Phase plane", SpeciesName(species[phase[0]]), SpeciesName(species[phase[1]]))
+		phasePlane = NewTracedPlot(phasePlot)
+	}
+
+	// the curves are drawn once, and every frame reveals them up to its time point
+	for k := 1; k < len(timePoints); k++ {
+		before, after := timePoints[k-1].species, timePoints[k].species
+		for i := range species {
+			if finite(before[i].population, after[i].population) {
+				TraceLine(lines, k, time*float64(k-1), before[i].population, time*float64(k), after[i].population, SpeciesColor(species[i]))
+			}
+		}
+		if phasePlane != nil && finite(before[phase[0]].population, before[phase[1]].population,
+			after[phase[0]].population, after[phase[1]].population) {
+			TraceLine(phasePlane, k, before[phase[0]].population, before[phase[1]].population,
+				after[phase[0]].population, after[phase[1]].population, CategoryColor(0))
+		}
+	}
+
+	// the last time point gets a frame even if it does not fall on the frequency
+	numFrames := (len(timePoints)-1)/frequency + 1
+	if (len(timePoints)-1)%frequency != 0 {
+		numFrames++
+	}
+
+	return numFrames, func(f int) image.Image {
+		k := min(f*frequency, len(timePoints)-1)
+
+		frame := TracedImage(lines, k)
+		for _, specie := range timePoints[k].species {
+			if finite(specie.population) {
+				PlotPoint(frame, time*float64(k), specie.population, 5, SpeciesColor(specie))
+			}
+		}
+		if phasePlane == nil {
+			return frame.img
+		}
+
+		phaseFrame := TracedImage(phasePlane, k)
+		if x, y := timePoints[k].species[phase[0]].population, timePoints[k].species[phase[1]].population; finite(x, y) {
+			PlotPoint(phaseFrame, x, y, 7, color.Black)
+		}
+		return SideBySide(frame.img, phaseFrame.img)
+	}
+}
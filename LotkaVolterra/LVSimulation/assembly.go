@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SpeciesPool is the regional pool of species that can invade a local community:
+// the growth rate of every species and the interactions between all of them.
+type SpeciesPool struct {
+	growth      []float64
+	interaction *mat.Dense // row i holds the effects of every pool species on species i
+}
+
+// PoolSettings holds the parameters of a randomly generated SpeciesPool.
+type PoolSettings struct {
+	size             int
+	producerFraction float64 // fraction of producers, which grow alone; the others are consumers
+	connectance      float64 // probability that two species interact
+	strength         float64 // largest interaction coefficient
+	efficiency       float64 // fraction of the consumption turned into consumer growth
+	selfLimitation   float64 // intraspecific competition of every species, on the diagonal
+}
+
+// AssemblySettings holds the parameters of a community assembly sequence.
+type AssemblySettings struct {
+	steps           int     // number of invasions
+	invasionDensity float64 // initial population of every invader
+	numGens         int     // generations simulated after every invasion to reach the new attractor
+	time            float64
+	threshold       float64 // population below which a species is pruned as extinct
+}
+
+// AssemblyStep is the outcome of one invasion of an assembly sequence.
+type AssemblyStep struct {
+	invader     int   // pool index of the invader
+	established bool  // true if the invader is in the community after the invasion
+	extinct     []int // pool indices of the resident species lost after the invasion
+	community   []int // pool indices of the species in the community after the invasion, in increasing order
+	populations []float64
+	turnover    float64 // Jaccard distance between the communities before and after the invasion
+}
+
+// GenerateSpeciesPool() takes pool settings and a random number generator, and returns a random SpeciesPool.
+// Like InitializeInteractionMatrix(), every pair of species interacts with coefficients drawn at random,
+// here with probability equal to the connectance, and the signs follow the roles of the species:
+// two producers compete, and a consumer eats a producer or a consumer with a lower index
+// (so that the food web has no loops), gaining efficiency times what its prey loses.
+// Like generateDeathGrowthSlice(), producers grow at a rate in (0, 1) and consumers die at a rate in (-1, 0).
+func GenerateSpeciesPool(settings PoolSettings, rng *rand.Rand) SpeciesPool {
+	n := settings.size
+	pool := SpeciesPool{growth: make([]float64, n), interaction: mat.NewDense(n, n, nil)}
+
+	producer := make([]bool, n)
+	for i := 0; i < n; i++ {
+		producer[i] = rng.Float64() < settings.producerFraction
+		if producer[i] {
+			pool.growth[i] = rng.Float64()
+		} else {
+			pool.growth[i] = rng.Float64() - 1
+		}
+		pool.interaction.Set(i, i, -settings.selfLimitation)
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if rng.Float64() >= settings.connectance {
+				continue
+			}
+
+			switch {
+			case producer[i] && producer[j]:
+				pool.interaction.Set(i, j, -rng.Float64()*settings.strength)
+				pool.interaction.Set(j, i, -rng.Float64()*settings.strength)
+			case !producer[j]:
+				// consumer j eats species i
+				u := rng.Float64() * settings.strength
+				pool.interaction.Set(i, j, -u)
+				pool.interaction.Set(j, i, settings.efficiency*u)
+			default:
+				// consumer i eats producer j
+				u := rng.Float64() * settings.strength
+				pool.interaction.Set(j, i, -u)
+				pool.interaction.Set(i, j, settings.efficiency*u)
+			}
+		}
+	}
+
+	return pool
+}
+
+// PoolEcosystem() takes a SpeciesPool, the pool indices of the members of a local community and their populations,
+// and returns the Ecosystem of these species. Every species is named after its pool index, e.g. "Pool 17".
+func PoolEcosystem(pool SpeciesPool, members []int, pop []float64) *Ecosystem {
+	n := len(members)
+	interaction := mat.NewDense(n, n, nil)
+	rateSlice := make([]float64, n)
+	metadata := make([]SpeciesMetadata, n)
+
+	for a, i := range members {
+		rateSlice[a] = pool.growth[i]
+		metadata[a].name = "Pool " + strconv.Itoa(i)
+		for b, j := range members {
+			interaction.Set(a, b, pool.interaction.At(i, j))
+		}
+	}
+
+	return InitializeEcosystem(n, pop, metadata, interaction, SetRateMatrix(rateSlice))
+}
+
+// AssembleCommunity() takes a SpeciesPool, assembly settings and a random number generator.
+// Starting from an empty community, it repeatedly introduces a randomly chosen pool species that is not in the community
+// at low density, simulates the community to its new attractor, and prunes the species that went extinct.
+// It returns every step of the assembly sequence; it stops early if every pool species is in the community.
+func AssembleCommunity(pool SpeciesPool, settings AssemblySettings, rng *rand.Rand) []AssemblyStep {
+	steps := make([]AssemblyStep, 0, settings.steps)
+	community := make([]int, 0)
+	populations := make([]float64, 0)
+
+	for step := 0; step < settings.steps; step++ {
+		// choose an invader among the species absent from the community
+		present := make(map[int]bool)
+		for _, i := range community {
+			present[i] = true
+		}
+		absent := make([]int, 0)
+		for i := range pool.growth {
+			if !present[i] {
+				absent = append(absent, i)
+			}
+		}
+		if len(absent) == 0 {
+			fmt.Println("Every pool species is in the community; assembly stopped after", step, "steps.")
+			break
+		}
+		invader := absent[rng.Intn(len(absent))]
+
+		// simulate the community with the invader to its new attractor
+		members := append(append([]int{}, community...), invader)
+		pop := append(append([]float64{}, populations...), settings.invasionDensity)
+		timePoints := SimulateEcosystemSampled(PoolEcosystem(pool, members, pop), settings.numGens, settings.time, settings.numGens)
+		final := timePoints[len(timePoints)-1]
+
+		// prune the extinct species
+		outcome := AssemblyStep{invader: invader}
+		newCommunity := make([]int, 0, len(members))
+		newPopulations := make([]float64, 0, len(members))
+		for a, i := range members {
+			if final.species[a].population > settings.threshold {
+				newCommunity = append(newCommunity, i)
+				newPopulations = append(newPopulations, final.species[a].population)
+				if i == invader {
+					outcome.established = true
+				}
+			} else if i != invader {
+				outcome.extinct = append(outcome.extinct, i)
+			}
+		}
+
+		outcome.turnover = JaccardDistance(community, newCommunity)
+		community, populations = SortCommunity(newCommunity, newPopulations)
+		outcome.community = community
+		outcome.populations = populations
+
+		steps = append(steps, outcome)
+	}
+
+	return steps
+}
+
+// SortCommunity() takes the pool indices of a community and their populations, and returns both sorted by pool index.
+func SortCommunity(members []int, populations []float64) ([]int, []float64) {
+	order := make([]int, len(members))
+	for k := range order {
+		order[k] = k
+	}
+	sort.Slice(order, func(a, b int) bool { return members[order[a]] < members[order[b]] })
+
+	sortedMembers := make([]int, len(members))
+	sortedPopulations := make([]float64, len(members))
+	for k, o := range order {
+		sortedMembers[k] = members[o]
+		sortedPopulations[k] = populations[o]
+	}
+
+	return sortedMembers, sortedPopulations
+}
+
+// JaccardDistance() takes two communities as slices of pool indices, and returns the fraction of the species
+// in either community that are not in both: 0 if they are the same, 1 if they share no species.
+func JaccardDistance(before, after []int) float64 {
+	inBefore := make(map[int]bool)
+	for _, i := range before {
+		inBefore[i] = true
+	}
+
+	shared := 0
+	for _, i := range after {
+		if inBefore[i] {
+			shared++
+		}
+	}
+
+	union := len(before) + len(after) - shared
+	if union == 0 {
+		return 0
+	}
+	return 1 - float64(shared)/float64(union)
+}
+
+// formatIndices() returns pool indices separated by spaces.
+func formatIndices(indices []int) string {
+	fields := make([]string, len(indices))
+	for k, i := range indices {
+		fields[k] = strconv.Itoa(i)
+	}
+	return strings.Join(fields, " ")
+}
+
+// WriteAssemblyCSV() writes an assembly sequence to a CSV file, with one row per invasion:
+// the invader, whether it established, the species lost, the richness, the turnover and the community after it.
+func WriteAssemblyCSV(steps []AssemblyStep, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Step", "Invader", "Established", "Extinctions", "Richness", "Turnover", "Community"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, step := range steps {
+		row := []string{
+			strconv.Itoa(k + 1),
+			strconv.Itoa(step.invader),
+			strconv.FormatBool(step.established),
+			formatIndices(step.extinct),
+			strconv.Itoa(len(step.community)),
+			strconv.FormatFloat(step.turnover, 'f', -1, 64),
+			formatIndices(step.community),
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// WriteNetworkCSV() writes the interaction network of the community after every invasion to a CSV file,
+// with one row per nonzero interaction between two different species: the effect of the source on the target.
+func WriteNetworkCSV(steps []AssemblyStep, pool SpeciesPool, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Step", "Source", "Target", "Coefficient"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, step := range steps {
+		for _, target := range step.community {
+			for _, source := range step.community {
+				coefficient := pool.interaction.At(target, source)
+				if source == target || coefficient == 0 {
+					continue
+				}
+				row := []string{strconv.Itoa(k + 1), strconv.Itoa(source), strconv.Itoa(target), strconv.FormatFloat(coefficient, 'f', -1, 64)}
+				if err := writer.Write(row); err != nil {
+					fmt.Println("Error writing row:", err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// CommunityScenario() takes a SpeciesPool, an assembly step and a name, and returns the Scenario of the community
+// after that step, starting from its populations there, so that it can be run by the scenario command.
+func CommunityScenario(pool SpeciesPool, step AssemblyStep, name string) Scenario {
+	scenario := Scenario{Name: name, Interaction: make([][]float64, len(step.community))}
+	for a, i := range step.community {
+		scenario.Species = append(scenario.Species, ScenarioSpecies{
+			Name:       "Pool " + strconv.Itoa(i),
+			Population: step.populations[a],
+			Growth:     pool.growth[i],
+		})
+		scenario.Interaction[a] = make([]float64, len(step.community))
+		for b, j := range step.community {
+			scenario.Interaction[a][b] = pool.interaction.At(i, j)
+		}
+	}
+	return scenario
+}
+
+// DrawAssembly() takes an assembly sequence, and returns a Plot of the richness of the community after every invasion.
+func DrawAssembly(steps []AssemblyStep) *Plot {
+	maxRichness := 1
+	for _, step := range steps {
+		maxRichness = max(maxRichness, len(step.community))
+	}
+
+	plot := NewPlot(600, 300, 0, float64(len(steps)), 0, float64(maxRichness)+1, 0)
+	previous := 0
+	for k, step := range steps {
+		PlotLine(plot, float64(k), float64(previous), float64(k+1), float64(len(step.community)), CategoryColor(0))
+		previous = len(step.community)
+	}
+	DrawAxes(plot, "Community assembly", "Invasion", "Richness")
+
+	return plot
+}
+
+// AssemblyCommand generates a regional species pool and assembles a local community from it by sequential invasions.
+// The sequence, the network after every invasion and the final community are written to ./output/<name>_assembly.csv,
+// ./output/<name>_network.csv and ./output/<name>_scenario.json, with the richness plotted in ./output/<name>_assembly.png.
+func AssemblyCommand(args []string) {
+	flags := flag.NewFlagSet("assembly", flag.ExitOnError)
+	poolSize := flags.Int("pool", 100, "number of species in the regional pool")
+	producerFraction := flags.Float64("producers", 0.4, "fraction of producers in the pool")
+	connectance := flags.Float64("connectance", 0.2, "probability that two pool species interact")
+	strength := flags.Float64("strength", 0.5, "largest interaction coefficient")
+	efficiency := flags.Float64("efficiency", 0.5, "fraction of the consumption turned into consumer growth")
+	selfLimitation := flags.Float64("self", 1, "intraspecific competition of every species")
+	numSteps := flags.Int("steps", 200, "number of invasions")
+	density := flags.Float64("density", 0.01, "initial population of every invader")
+	numGens := flags.Int("gens", 25000, "generations simulated after every invasion")
+	threshold := flags.Float64("threshold", 1e-4, "population below which a species is pruned as extinct")
+	seed := flags.Int64("seed", 0, "random seed (default from the clock)")
+	name := flags.String("name", "assembly", "name of the output files")
+	flags.Parse(args)
+
+	if *poolSize <= 0 || *numSteps <= 0 || *numGens <= 0 {
+		panic("Error: nonpositive number given as pool size, number of invasions or number of generations.")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	fmt.Println("Random seed:", *seed)
+
+	pool := GenerateSpeciesPool(PoolSettings{
+		size:             *poolSize,
+		producerFraction: *producerFraction,
+		connectance:      *connectance,
+		strength:         *strength,
+		efficiency:       *efficiency,
+		selfLimitation:   *selfLimitation,
+	}, rng)
+
+	settings := AssemblySettings{
+		steps:           *numSteps,
+		invasionDensity: *density,
+		numGens:         *numGens,
+		time:            DefaultSettings(*name).time,
+		threshold:       *threshold,
+	}
+
+	fmt.Println("Assembling a community from a pool of", *poolSize, "species...")
+	steps := AssembleCommunity(pool, settings, rng)
+	if len(steps) == 0 {
+		return
+	}
+
+	established, extinctions := 0, 0
+	for _, step := range steps {
+		if step.established {
+			established++
+		}
+		extinctions += len(step.extinct)
+	}
+	last := steps[len(steps)-1]
+	fmt.Printf("%d invasions, %d established, %d extinctions; final richness %d\n", len(steps), established, extinctions, len(last.community))
+
+	filename := "./output/" + *name
+	WriteAssemblyCSV(steps, filename+"_assembly.csv")
+	WriteNetworkCSV(steps, pool, filename+"_network.csv")
+	WriteScenario(CommunityScenario(pool, last, *name), filename+"_scenario.json")
+	SavePNG(DrawAssembly(steps).img, filename+"_assembly.png")
+	fmt.Println("Assembly written to " + filename + "_assembly.csv, _network.csv, _scenario.json and _assembly.png")
+}
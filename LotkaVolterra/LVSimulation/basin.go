@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BasinSettings holds the parameters of a basin-of-attraction map.
+type BasinSettings struct {
+	x, y                   int // indices of the two species whose initial populations are varied
+	xMin, xMax, yMin, yMax float64
+	resolution             int     // grid points per axis
+	samples                int     // number of Latin hypercube samples, or 0 to use the grid
+	threshold              float64 // final population below which a species counts as extinct
+	workers                int     // number of simulations run in parallel
+	simulation             SimulationSettings
+}
+
+// FinalState is the classification of where a simulation ended up: the species that survive,
+// and whether their populations settle on an equilibrium or keep oscillating.
+type FinalState struct {
+	survivors []int
+	dynamics  string // "equilibrium", "cycle" or "diverged"
+}
+
+// BasinPoint is one simulation of a basin map: the initial populations of the two varied species,
+// the final population of every species and the final state.
+type BasinPoint struct {
+	x, y  float64
+	final []float64
+	state FinalState
+}
+
+// BasinGrid() takes basin settings, and returns the initial populations of the two varied species
+// at the centers of a resolution x resolution grid of cells covering their ranges.
+func BasinGrid(settings BasinSettings) [][2]float64 {
+	n := settings.resolution
+	dx := (settings.xMax - settings.xMin) / float64(n)
+	dy := (settings.yMax - settings.yMin) / float64(n)
+
+	points := make([][2]float64, 0, n*n)
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			points = append(points, [2]float64{settings.xMin + (float64(i)+0.5)*dx, settings.yMin + (float64(j)+0.5)*dy})
+		}
+	}
+
+	return points
+}
+
+// LatinHypercube() takes basin settings, and returns settings.samples initial populations of the two varied species
+// drawn by Latin hypercube sampling: each range is cut into as many strata as samples, and every stratum
+// of each species is used exactly once, at a random position within it.
+func LatinHypercube(settings BasinSettings) [][2]float64 {
+	n := settings.samples
+	xStrata := rand.Perm(n)
+	yStrata := rand.Perm(n)
+
+	points := make([][2]float64, n)
+	for k := 0; k < n; k++ {
+		points[k][0] = settings.xMin + (float64(xStrata[k])+rand.Float64())/float64(n)*(settings.xMax-settings.xMin)
+		points[k][1] = settings.yMin + (float64(yStrata[k])+rand.Float64())/float64(n)*(settings.yMax-settings.yMin)
+	}
+
+	return points
+}
+
+// ClassifyFinalState() takes the time points of a simulation and an extinction threshold, and returns its FinalState.
+// Species above the threshold at the end survive. The dynamics are judged on the last quarter of the time points:
+// if every survivor varies by less than 0.1% of its mean there, the populations are at an equilibrium,
+// otherwise they are on a cycle (or another oscillating attractor).
+func ClassifyFinalState(timePoints []*Ecosystem, threshold float64) FinalState {
+	last := timePoints[len(timePoints)-1]
+	window := timePoints[len(timePoints)*3/4:]
+	state := FinalState{dynamics: "equilibrium"}
+
+	for _, specie := range last.species {
+		if math.IsNaN(specie.population) || math.IsInf(specie.population, 0) {
+			return FinalState{dynamics: "diverged"}
+		}
+		if specie.population <= threshold {
+			continue
+		}
+		state.survivors = append(state.survivors, specie.index)
+
+		series := PopulationSeries(window, specie.index)
+		mean, low, high, _ := DescribeSeries(series)
+		if (high-low)/mean > 1e-3 {
+			state.dynamics = "cycle"
+		}
+	}
+
+	return state
+}
+
+// FinalStateLabel() takes a FinalState and the species of the ecosystem, and returns a label
+// naming the surviving species and the dynamics, e.g. "Species 0 + Species 2, equilibrium".
+func FinalStateLabel(state FinalState, species []*Specie) string {
+	if state.dynamics == "diverged" {
+		return "diverged"
+	}
+	if len(state.survivors) == 0 {
+		return "none survive"
+	}
+
+	names := make([]string, len(state.survivors))
+	for k, index := range state.survivors {
+		names[k] = SpeciesName(species[index])
+	}
+
+	return strings.Join(names, " + ") + ", " + state.dynamics
+}
+
+// MapBasins() takes the initial *Ecosystem object, basin settings and the initial populations of the two varied species.
+// It simulates the ecosystem from every initial condition, keeping the other species at their initial populations,
+// with settings.workers simulations running in parallel. It returns one BasinPoint per initial condition, in the same order.
+func MapBasins(initialEcosystem *Ecosystem, settings BasinSettings, initialPops [][2]float64) []BasinPoint {
+	points := make([]BasinPoint, len(initialPops))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < settings.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				ecosystem := Copy(initialEcosystem)
+				ecosystem.species[settings.x].population = initialPops[k][0]
+				ecosystem.species[settings.y].population = initialPops[k][1]
+
+				timePoints := SimulateWithSettings(ecosystem, settings.simulation)
+				last := timePoints[len(timePoints)-1]
+
+				// every job writes its own element, so no lock is needed
+				points[k] = BasinPoint{
+					x:     initialPops[k][0],
+					y:     initialPops[k][1],
+					final: make([]float64, len(last.species)),
+					state: ClassifyFinalState(timePoints, settings.threshold),
+				}
+				for _, specie := range last.species {
+					points[k].final[specie.index] = specie.population
+				}
+			}
+		}()
+	}
+
+	for k := range initialPops {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+
+	return points
+}
+
+// BasinLabels() takes the points of a basin map and the species, and returns the label of every point
+// together with the distinct labels in alphabetical order, which index the colors of the map.
+func BasinLabels(points []BasinPoint, species []*Specie) ([]string, []string) {
+	labels := make([]string, len(points))
+	seen := make(map[string]bool)
+	distinct := make([]string, 0)
+
+	for k, point := range points {
+		labels[k] = FinalStateLabel(point.state, species)
+		if !seen[labels[k]] {
+			seen[labels[k]] = true
+			distinct = append(distinct, labels[k])
+		}
+	}
+	sort.Strings(distinct)
+
+	return labels, distinct
+}
+
+// WriteBasinCSV() writes the points of a basin map to a CSV file, with the initial populations of the two varied species,
+// the final state and the final population of every species.
+func WriteBasinCSV(points []BasinPoint, labels []string, species []*Specie, settings BasinSettings, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Initial " + SpeciesName(species[settings.x]), "Initial " + SpeciesName(species[settings.y]), "Survivors", "Dynamics", "State"}
+	for _, specie := range species {
+		header = append(header, "Final "+SpeciesName(specie))
+	}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, point := range points {
+		survivors := make([]string, len(point.state.survivors))
+		for s, index := range point.state.survivors {
+			survivors[s] = strconv.Itoa(index)
+		}
+
+		row := []string{
+			strconv.FormatFloat(point.x, 'f', -1, 64),
+			strconv.FormatFloat(point.y, 'f', -1, 64),
+			strings.Join(survivors, " "),
+			point.state.dynamics,
+			labels[k],
+		}
+		for _, value := range point.final {
+			row = append(row, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// DrawBasinMap() takes the points of a basin map, their labels, the distinct labels, the species and the settings.
+// It returns a Plot coloring every initial condition by its final state: whole cells for a grid,
+// or markers for Latin hypercube samples.
+func DrawBasinMap(points []BasinPoint, labels, distinct []string, species []*Specie, settings BasinSettings) *Plot {
+	plot := NewPlot(500, 500, settings.xMin, settings.xMax, settings.yMin, settings.yMax, len(distinct))
+
+	colorOf := make(map[string]color.Color)
+	legendColors := make([]color.Color, len(distinct))
+	for k, label := range distinct {
+		colorOf[label] = CategoryColor(k)
+		legendColors[k] = colorOf[label]
+	}
+
+	dx := (settings.xMax - settings.xMin) / float64(settings.resolution)
+	dy := (settings.yMax - settings.yMin) / float64(settings.resolution)
+	for k, point := range points {
+		if settings.samples > 0 {
+			PlotPoint(plot, point.x, point.y, 6, colorOf[labels[k]])
+		} else {
+			PlotRect(plot, point.x-dx/2, point.y-dy/2, point.x+dx/2, point.y+dy/2, colorOf[labels[k]])
+		}
+	}
+
+	DrawAxes(plot, "Basins of attraction", "Initial "+SpeciesName(species[settings.x]), "Initial "+SpeciesName(species[settings.y]))
+	DrawPlotLegend(plot, distinct, legendColors)
+
+	return plot
+}
+
+// SpeciesIndex() takes the species of an ecosystem and a CLA naming one of them, either by index or by name
+// (e.g. "Hare (adult)" for a stage), and returns its index.
+func SpeciesIndex(species []*Specie, key string) int {
+	if index, err := strconv.Atoi(key); err == nil {
+		if index < 0 || index >= len(species) {
+			panic("Error: species index " + key + " out of range.")
+		}
+		return index
+	}
+
+	for _, specie := range species {
+		if strings.EqualFold(SpeciesName(specie), key) {
+			return specie.index
+		}
+	}
+
+	panic("Error: no species named " + key)
+}
+
+// BasinCommand maps the basins of attraction of a scenario file or preset over the initial populations of two species.
+// The final states are written to ./output/<name>_basins.csv and drawn to ./output/<name>_basins.png.
+func BasinCommand(args []string) {
+	flags := flag.NewFlagSet("basin", flag.ExitOnError)
+	xKey := flags.String("x", "0", "index or name of the species on the x axis")
+	yKey := flags.String("y", "1", "index or name of the species on the y axis")
+	xMin := flags.Float64("xmin", 0, "smallest initial population on the x axis")
+	xMax := flags.Float64("xmax", 0, "largest initial population on the x axis (default twice the scenario's)")
+	yMin := flags.Float64("ymin", 0, "smallest initial population on the y axis")
+	yMax := flags.Float64("ymax", 0, "largest initial population on the y axis (default twice the scenario's)")
+	resolution := flags.Int("n", 40, "number of grid points per axis")
+	samples := flags.Int("lhs", 0, "number of Latin hypercube samples to use instead of the grid")
+	threshold := flags.Float64("threshold", 1e-3, "final population below which a species counts as extinct")
+	numGens := flags.Int("gens", 0, "number of generations of every run (default the scenario's)")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of simulations run in parallel")
+	name := flags.String("name", "", "name of the output files (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the basin command takes the name of a scenario file or preset.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	initialEcosystem := BuildEcosystem(scenario)
+	species := initialEcosystem.species
+
+	simulation := ScenarioSettings(scenario)
+	if *numGens > 0 {
+		simulation.numGens = *numGens
+	}
+	// only a few hundred time points are needed to classify the final state
+	simulation.sampleEvery = max(1, simulation.numGens/400)
+	if *name != "" {
+		simulation.name = *name
+	}
+
+	settings := BasinSettings{
+		x:          SpeciesIndex(species, *xKey),
+		y:          SpeciesIndex(species, *yKey),
+		xMin:       *xMin,
+		xMax:       *xMax,
+		yMin:       *yMin,
+		yMax:       *yMax,
+		resolution: *resolution,
+		samples:    *samples,
+		threshold:  *threshold,
+		workers:    max(1, *workers),
+		simulation: simulation,
+	}
+	if settings.x == settings.y {
+		panic("Error: the basin map needs two different species.")
+	}
+	if settings.xMax == 0 {
+		settings.xMax = 2 * species[settings.x].population
+	}
+	if settings.yMax == 0 {
+		settings.yMax = 2 * species[settings.y].population
+	}
+	if settings.resolution <= 0 || settings.samples < 0 {
+		panic("Error: nonpositive number given as number of initial conditions.")
+	}
+
+	var initialPops [][2]float64
+	if settings.samples > 0 {
+		initialPops = LatinHypercube(settings)
+	} else {
+		initialPops = BasinGrid(settings)
+	}
+
+	fmt.Println("Simulating", len(initialPops), "initial conditions with", settings.workers, "workers...")
+	points := MapBasins(initialEcosystem, settings, initialPops)
+	labels, distinct := BasinLabels(points, species)
+
+	// report how much of the sampled region every final state takes
+	counts := make(map[string]int)
+	for _, label := range labels {
+		counts[label]++
+	}
+	for _, label := range distinct {
+		fmt.Printf("%6.1f%%  %s\n", 100*float64(counts[label])/float64(len(labels)), label)
+	}
+
+	filename := "./output/" + simulation.name + "_basins"
+	WriteBasinCSV(points, labels, species, settings, filename+".csv")
+	SavePNG(DrawBasinMap(points, labels, distinct, species, settings).img, filename+".png")
+	fmt.Println("Basin map written to " + filename + ".csv and .png")
+}
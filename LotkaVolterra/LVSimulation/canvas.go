@@ -0,0 +1,191 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Canvas is a drawing surface built on image.RGBA, used to draw the ecosystem boards without any package outside the
+// standard library. Like a vector graphics context, shapes are first added to a path with MoveTo(), LineTo() and Circle(),
+// then painted with Fill() or Stroke(), which clear the path.
+type Canvas struct {
+	img         *image.RGBA
+	fillColor   color.Color
+	strokeColor color.Color
+	lineWidth   float64
+	path        [][]canvasPoint // the subpaths of the current path, each a polyline
+	closed      []bool          // whether every subpath is a closed shape, such as a circle
+}
+
+// canvasPoint is a point of a path, in pixels with y growing downwards.
+type canvasPoint struct {
+	x, y float64
+}
+
+// CreateNewCanvas() takes a width and a height in pixels, and returns a white Canvas of that size
+// with black fill and stroke colors and lines one pixel wide.
+func CreateNewCanvas(width, height int) *Canvas {
+	c := &Canvas{
+		img:         image.NewRGBA(image.Rect(0, 0, width, height)),
+		fillColor:   color.White,
+		strokeColor: color.Black,
+		lineWidth:   1,
+	}
+	c.ClearRect(0, 0, width, height)
+	c.fillColor = color.Black
+	return c
+}
+
+// MakeColor() takes the red, green and blue channels of a color, and returns the opaque color.
+func MakeColor(r, g, b uint8) color.Color {
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// SetFillColor() sets the color used by Fill(), ClearRect() and FillString().
+func (c *Canvas) SetFillColor(fill color.Color) {
+	c.fillColor = fill
+}
+
+// SetStrokeColor() sets the color used by Stroke().
+func (c *Canvas) SetStrokeColor(stroke color.Color) {
+	c.strokeColor = stroke
+}
+
+// SetLineWidth() sets the width in pixels of the lines drawn by Stroke().
+func (c *Canvas) SetLineWidth(width float64) {
+	c.lineWidth = width
+}
+
+// ClearRect() paints the rectangle of the given corner and size with the fill color, regardless of the path.
+func (c *Canvas) ClearRect(x, y, width, height int) {
+	rect := image.Rect(x, y, x+width, y+height).Intersect(c.img.Bounds())
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			c.img.Set(px, py, c.fillColor)
+		}
+	}
+}
+
+// MoveTo() starts a new subpath at a point.
+func (c *Canvas) MoveTo(x, y float64) {
+	c.path = append(c.path, []canvasPoint{{x, y}})
+	c.closed = append(c.closed, false)
+}
+
+// LineTo() adds a line from the last point of the path to a point, starting a subpath there if the path is empty.
+func (c *Canvas) LineTo(x, y float64) {
+	if len(c.path) == 0 {
+		c.MoveTo(x, y)
+		return
+	}
+	last := len(c.path) - 1
+	c.path[last] = append(c.path[last], canvasPoint{x, y})
+}
+
+// Circle() adds a circle of the given center and radius to the path, as a closed polygon
+// with enough sides that its edges stay within a fraction of a pixel of the circle.
+func (c *Canvas) Circle(x, y, r float64) {
+	sides := max(16, int(4*r))
+	points := make([]canvasPoint, sides)
+	for k := range points {
+		angle := 2 * math.Pi * float64(k) / float64(sides)
+		points[k] = canvasPoint{x + r*math.Cos(angle), y + r*math.Sin(angle)}
+	}
+	c.path = append(c.path, points)
+	c.closed = append(c.closed, true)
+}
+
+// Fill() paints the inside of the path with the fill color, and clears the path. Open subpaths are closed by a line
+// back to their first point, and points inside an even number of subpaths are outside the path, so that
+// nested shapes leave holes. A pixel is inside the path if its center is.
+func (c *Canvas) Fill() {
+	bounds := c.img.Bounds()
+	crossings := make([]float64, 0)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		// the x coordinates at which the edges of the path cross the horizontal line through the pixel centers
+		y := float64(py) + 0.5
+		crossings = crossings[:0]
+		for _, points := range c.path {
+			for k := range points {
+				a, b := points[k], points[(k+1)%len(points)]
+				if (a.y <= y) != (b.y <= y) {
+					crossings = append(crossings, a.x+(y-a.y)*(b.x-a.x)/(b.y-a.y))
+				}
+			}
+		}
+		sort.Float64s(crossings)
+
+		for k := 0; k+1 < len(crossings); k += 2 {
+			first := max(bounds.Min.X, int(math.Ceil(crossings[k]-0.5)))
+			last := min(bounds.Max.X-1, int(math.Floor(crossings[k+1]-0.5)))
+			for px := first; px <= last; px++ {
+				c.img.Set(px, py, c.fillColor)
+			}
+		}
+	}
+	c.clearPath()
+}
+
+// Stroke() draws the lines of the path with the stroke color and line width, and clears the path.
+func (c *Canvas) Stroke() {
+	for s, points := range c.path {
+		segments := len(points) - 1
+		if c.closed[s] {
+			segments = len(points)
+		}
+		for k := 0; k < segments; k++ {
+			c.strokeSegment(points[k], points[(k+1)%len(points)])
+		}
+	}
+	c.clearPath()
+}
+
+// strokeSegment() paints every pixel whose center is within half the line width of the segment from a to b.
+func (c *Canvas) strokeSegment(a, b canvasPoint) {
+	half := math.Max(c.lineWidth, 1) / 2
+	rect := image.Rect(
+		int(math.Floor(math.Min(a.x, b.x)-half)), int(math.Floor(math.Min(a.y, b.y)-half)),
+		int(math.Ceil(math.Max(a.x, b.x)+half))+1, int(math.Ceil(math.Max(a.y, b.y)+half))+1,
+	).Intersect(c.img.Bounds())
+
+	dx, dy := b.x-a.x, b.y-a.y
+	length2 := dx*dx + dy*dy
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			x, y := float64(px)+0.5, float64(py)+0.5
+
+			// the nearest point of the segment to the pixel center is a + t (b - a)
+			t := 0.0
+			if length2 > 0 {
+				t = math.Max(0, math.Min(1, ((x-a.x)*dx+(y-a.y)*dy)/length2))
+			}
+			if math.Hypot(x-a.x-t*dx, y-a.y-t*dy) <= half {
+				c.img.Set(px, py, c.strokeColor)
+			}
+		}
+	}
+}
+
+// clearPath() removes every subpath of the path.
+func (c *Canvas) clearPath() {
+	c.path = c.path[:0]
+	c.closed = c.closed[:0]
+}
+
+// FillString() writes text with its top left corner at a point in the fill color, with the bitmap font of DrawText()
+// scaled by an integer factor.
+func (c *Canvas) FillString(text string, x, y, scale int) {
+	DrawText(c.img, x, y, text, c.fillColor, scale)
+}
+
+// GetImage() returns the image drawn on the Canvas. It is not copied, so later drawing changes it.
+func (c *Canvas) GetImage() *image.RGBA {
+	return c.img
+}
+
+// SaveToPNG() writes the image drawn on the Canvas to a PNG file.
+func (c *Canvas) SaveToPNG(filename string) {
+	SavePNG(c.img, filename)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// commands maps the name of each command that can be given as the first CLA to the function running it.
+// Each function takes the remaining CLAs.
+var commands = map[string]func(args []string){
+	"competition":  CompetitionCommand,
+	"scenario":     ScenarioCommand,
+	"infer":        InferCommand,
+	"basin":        BasinCommand,
+	"continuation": ContinuationCommand,
+	"poincare":     PoincareCommand,
+	"assembly":     AssemblyCommand,
+	"evolve":       EvolveCommand,
+	"verify":       VerifyCommand,
+	"dashboard":    DashboardCommand,
+	"foodweb":      FoodWebCommand,
+	"keystone":     KeystoneCommand,
+	"press":        PressCommand,
+	"resilience":   ResilienceCommand,
+	"feasibility":  FeasibilityCommand,
+}
+
+// ParseIntArg() takes a slice of CLAs and an index, and returns the CLA at that index parsed as an int.
+func ParseIntArg(args []string, index int) int {
+	if index >= len(args) {
+		panic("Error: not enough command line arguments given.")
+	}
+
+	value, err := strconv.Atoi(args[index])
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+// ParseFloatArgs() takes a slice of CLAs, a start index and a count n,
+// and returns the n CLAs starting at that index parsed as float64 numbers.
+func ParseFloatArgs(args []string, start, n int) []float64 {
+	if start+n > len(args) {
+		panic("Error: not enough command line arguments given.")
+	}
+
+	values := make([]float64, n)
+	for i := 0; i < n; i++ {
+		value, err := strconv.ParseFloat(args[start+i], 64)
+		if err != nil {
+			panic(err)
+		}
+		values[i] = value
+	}
+
+	return values
+}
+
+// ParseSpeciesMetadata() takes a slice of CLAs, a start index and the number of species.
+// If there are at least numSpecies CLAs from the start index, each is read as "name[:role][:#rrggbb]"
+// (for example "Hare:producer:#ffcc00") and the metadata of every species is returned.
+// Otherwise it returns nil, so that the default names, roles and colors are used.
+func ParseSpeciesMetadata(args []string, start, numSpecies int) []SpeciesMetadata {
+	if start+numSpecies > len(args) {
+		return nil
+	}
+
+	metadata := make([]SpeciesMetadata, numSpecies)
+	for i := 0; i < numSpecies; i++ {
+		fields := strings.Split(args[start+i], ":")
+		metadata[i].name = fields[0]
+
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "#"):
+				metadata[i].color = ParseHexColor(field)
+			case field == "producer" || field == "consumer":
+				metadata[i].role = field
+			default:
+				panic("Error: species attribute must be a role (producer/consumer) or a color (#rrggbb): " + field)
+			}
+		}
+	}
+
+	return metadata
+}
+
+// ParseHexColor() takes a color written as "#rrggbb", and returns its RGB values.
+func ParseHexColor(hex string) []uint8 {
+	if len(hex) != 7 || hex[0] != '#' {
+		panic("Error: color must be written as #rrggbb: " + hex)
+	}
+
+	color := make([]uint8, 3)
+	for i := 0; i < 3; i++ {
+		value, err := strconv.ParseUint(hex[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			panic(err)
+		}
+		color[i] = uint8(value)
+	}
+
+	return color
+}
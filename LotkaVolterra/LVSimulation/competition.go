@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// CompetitionParameters holds the parameters of the competitive LV model
+// dx_i/dt = r_i x_i (1 - Σ_j α_ij x_j / K_i).
+type CompetitionParameters struct {
+	growth   []float64  // intrinsic growth rates r_i
+	capacity []float64  // carrying capacities K_i
+	alpha    mat.Matrix // competition coefficients α_ij, the effect of species j on species i
+}
+
+// PairCoexistence holds the modern coexistence theory quantities for one pair of competitors.
+type PairCoexistence struct {
+	i, j         int
+	nicheOverlap float64 // ρ; the niche difference is 1 - ρ
+	fitnessRatio float64 // κ_j / κ_i
+	outcome      string  // "coexistence", "priority effect" or "exclusion"
+	winner       int     // index of the excluding species, or -1 if there is no exclusion
+}
+
+// CompetitionToLV() takes a CompetitionParameters object, and returns the interaction and deathGrowth matrices
+// of the equivalent LV model dx_i/dt = x_i (r_i + Σ_j a_ij x_j), with a_ij = -r_i α_ij / K_i.
+func CompetitionToLV(params CompetitionParameters) (mat.Matrix, mat.Matrix) {
+	n := len(params.growth)
+
+	interaction := mat.NewDense(n, n, nil)
+	for i := 0; i < n; i++ {
+		if params.capacity[i] <= 0 {
+			panic("Error: nonpositive number given as carrying capacity.")
+		}
+		for j := 0; j < n; j++ {
+			interaction.Set(i, j, -params.growth[i]*params.alpha.At(i, j)/params.capacity[i])
+		}
+	}
+
+	deathGrowth := SetRateMatrix(append([]float64(nil), params.growth...))
+
+	return interaction, deathGrowth
+}
+
+// InitializeCompetitiveEcosystem() takes the number of species, their initial populations and metadata, and the parameters
+// of the competitive LV model, and returns an Ecosystem object that SimulateEcosystem can run.
+func InitializeCompetitiveEcosystem(numSpecies int, pop []float64, metadata []SpeciesMetadata, params CompetitionParameters) *Ecosystem {
+	interaction, deathGrowth := CompetitionToLV(params)
+	return InitializeEcosystem(numSpecies, pop, metadata, interaction, deathGrowth)
+}
+
+// CoexistenceReport() takes a CompetitionParameters object, and returns the coexistence conditions of every pair of species.
+// With β_ij = α_ij / K_i, the niche overlap is ρ = sqrt(β_ij β_ji / (β_ii β_jj)) and the fitness ratio is
+// κ_j / κ_i = sqrt(β_ij β_ii / (β_jj β_ji)). The pair coexists when ρ < κ_j / κ_i < 1 / ρ.
+func CoexistenceReport(params CompetitionParameters) []PairCoexistence {
+	n := len(params.growth)
+
+	beta := func(i, j int) float64 {
+		return params.alpha.At(i, j) / params.capacity[i]
+	}
+
+	report := make([]PairCoexistence, 0)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pair := PairCoexistence{i: i, j: j, winner: -1}
+			pair.nicheOverlap = math.Sqrt(beta(i, j) * beta(j, i) / (beta(i, i) * beta(j, j)))
+			pair.fitnessRatio = math.Sqrt(beta(i, j) * beta(i, i) / (beta(j, j) * beta(j, i)))
+
+			// invasion criteria: each species can grow when rare with the other at its carrying capacity
+			iInvades := beta(i, j) < beta(j, j)
+			jInvades := beta(j, i) < beta(i, i)
+
+			switch {
+			case iInvades && jInvades:
+				pair.outcome = "coexistence"
+			case !iInvades && !jInvades:
+				pair.outcome = "priority effect"
+			case iInvades:
+				pair.outcome = "exclusion"
+				pair.winner = i
+			default:
+				pair.outcome = "exclusion"
+				pair.winner = j
+			}
+
+			report = append(report, pair)
+		}
+	}
+
+	return report
+}
+
+// PrintCoexistenceReport prints the pairwise coexistence conditions as a table on stdout, naming the species.
+func PrintCoexistenceReport(report []PairCoexistence, species []*Specie) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Pair\tNiche overlap ρ\tNiche difference 1-ρ\tFitness ratio κj/κi\tOutcome")
+
+	for _, pair := range report {
+		outcome := pair.outcome
+		if pair.winner >= 0 {
+			loser := pair.i + pair.j - pair.winner
+			outcome = SpeciesName(species[pair.winner]) + " excludes " + SpeciesName(species[loser])
+		}
+
+		fmt.Fprintf(writer, "%s - %s\t%.4g\t%.4g\t%.4g\t%s\n",
+			SpeciesName(species[pair.i]), SpeciesName(species[pair.j]),
+			pair.nicheOverlap, 1-pair.nicheOverlap, pair.fitnessRatio, outcome)
+	}
+
+	writer.Flush()
+}
+
+// CompetitionCommand runs the competitive LV model. Its CLAs are the number of species n, followed by
+// n initial populations, n intrinsic growth rates, n carrying capacities and the n*n competition coefficients
+// α_ij given row by row (row i holds the effects of every species on species i), and optionally n species names.
+func CompetitionCommand(args []string) {
+	numSpecies := ParseIntArg(args, 0)
+	if numSpecies <= 0 {
+		panic("Error: nonpositive number given as number of species.")
+	}
+
+	pop := ParseFloatArgs(args, 1, numSpecies)
+	for _, p := range pop {
+		if p <= 0 {
+			panic("Error: nonpositive number given as population.")
+		}
+	}
+
+	params := CompetitionParameters{
+		growth:   ParseFloatArgs(args, 1+numSpecies, numSpecies),
+		capacity: ParseFloatArgs(args, 1+2*numSpecies, numSpecies),
+		alpha:    mat.NewDense(numSpecies, numSpecies, ParseFloatArgs(args, 1+3*numSpecies, numSpecies*numSpecies)),
+	}
+
+	fmt.Println("numSpecies:", numSpecies, "pop:", pop, "growth:", params.growth, "capacity:", params.capacity)
+
+	metadata := ParseSpeciesMetadata(args, 1+3*numSpecies+numSpecies*numSpecies, numSpecies)
+
+	initialEcosystem := InitializeCompetitiveEcosystem(numSpecies, pop, metadata, params)
+
+	fmt.Println("Pairwise coexistence conditions:")
+	PrintCoexistenceReport(CoexistenceReport(params), initialEcosystem.species)
+
+	fmt.Println("Equilibrium analysis:")
+	PrintEquilibriumReport(AnalyzeEquilibrium(initialEcosystem), initialEcosystem.species)
+
+	RunSimulation(initialEcosystem, DefaultSettings("competition"))
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ContinuationParameter identifies the parameter varied along a branch of equilibria:
+// the growth rate r_i, or the interaction a_ij (the effect of species j on species i).
+type ContinuationParameter struct {
+	kind string // "r" or "a"
+	i, j int
+}
+
+// BranchPoint is one equilibrium on a branch, with the eigenvalues of the Jacobian there.
+type BranchPoint struct {
+	parameter   float64
+	populations []float64
+	eigenvalues []complex128 // sorted by decreasing real part
+	stable      bool
+	tangent     float64 // derivative of the parameter along the branch, which changes sign at a fold
+}
+
+// Bifurcation is a point of a branch where the stability of the equilibrium changes.
+type Bifurcation struct {
+	kind        string // "fold", "transcritical" or "hopf"
+	parameter   float64
+	populations []float64
+	point       int // index of the branch point just before the bifurcation
+}
+
+// ContinuationSettings holds the parameters of a pseudo-arclength continuation.
+type ContinuationSettings struct {
+	parameter          ContinuationParameter
+	minValue, maxValue float64 // the branch is followed while the parameter stays in this range
+	step, maxStep      float64 // initial and largest arclength step
+	maxPoints          int     // largest number of points in each direction
+}
+
+// ParseContinuationParameter() takes a CLA of the form "r:i" or "a:i:j" and the number of species,
+// and returns the ContinuationParameter it names.
+func ParseContinuationParameter(key string, numSpecies int) ContinuationParameter {
+	fields := strings.Split(key, ":")
+	indices := make([]int, len(fields)-1)
+	for k := range indices {
+		index, err := strconv.Atoi(fields[k+1])
+		if err != nil {
+			panic(err)
+		}
+		if index < 0 || index >= numSpecies {
+			panic("Error: species index out of range in parameter " + key)
+		}
+		indices[k] = index
+	}
+
+	switch {
+	case fields[0] == "r" && len(indices) == 1:
+		return ContinuationParameter{kind: "r", i: indices[0]}
+	case fields[0] == "a" && len(indices) == 2:
+		return ContinuationParameter{kind: "a", i: indices[0], j: indices[1]}
+	default:
+		panic("Error: parameter " + key + " must be given as r:i or a:i:j.")
+	}
+}
+
+// ParameterName() returns the name of a ContinuationParameter, as written on the command line.
+func ParameterName(parameter ContinuationParameter) string {
+	if parameter.kind == "r" {
+		return "r:" + strconv.Itoa(parameter.i)
+	}
+	return "a:" + strconv.Itoa(parameter.i) + ":" + strconv.Itoa(parameter.j)
+}
+
+// ParameterValue() takes a pointer of Ecosystem object and a ContinuationParameter, and returns the value of the parameter.
+func ParameterValue(ecosystem *Ecosystem, parameter ContinuationParameter) float64 {
+	if parameter.kind == "r" {
+		return ecosystem.deathGrowth.At(parameter.i, 0)
+	}
+	return ecosystem.interaction.At(parameter.i, parameter.j)
+}
+
+// SetParameter() takes a pointer of Ecosystem object, a ContinuationParameter and a value,
+// and returns a copy of the ecosystem with the parameter set to that value.
+func SetParameter(ecosystem *Ecosystem, parameter ContinuationParameter, value float64) *Ecosystem {
+	newEcosystem := Copy(ecosystem)
+
+	if parameter.kind == "r" {
+		deathGrowth := mat.DenseCopyOf(newEcosystem.deathGrowth)
+		deathGrowth.Set(parameter.i, 0, value)
+		newEcosystem.deathGrowth = deathGrowth
+	} else {
+		interaction := mat.DenseCopyOf(newEcosystem.interaction)
+		interaction.Set(parameter.i, parameter.j, value)
+		newEcosystem.interaction = interaction
+	}
+
+	return newEcosystem
+}
+
+// VectorField() takes a pointer of Ecosystem object and a slice of populations, and returns the rates of change
+// dx_i/dt = x_i (r_i + Σ_j a_ij x_j + Σ_jk b_ijk x_j x_k), plus the stage flows for stage-structured species.
+// With prey switching, a_ij is the switched interaction of EffectiveInteraction().
+func VectorField(ecosystem *Ecosystem, x []float64) []float64 {
+	n := len(x)
+	f := make([]float64, n)
+	interaction := EffectiveInteraction(ecosystem, x)
+
+	for i := 0; i < n; i++ {
+		growth := ecosystem.deathGrowth.At(i, 0)
+		for j := 0; j < n; j++ {
+			growth += interaction.At(i, j) * x[j]
+		}
+		if ecosystem.higherOrder != nil {
+			growth += HigherOrderTerm(ecosystem.higherOrder, i, x)
+		}
+		f[i] = x[i] * growth
+
+		if ecosystem.stageTransfer != nil {
+			for j := 0; j < n; j++ {
+				f[i] += ecosystem.stageTransfer.At(i, j) * x[j]
+			}
+		}
+	}
+
+	return f
+}
+
+// ParameterDerivative() takes a ContinuationParameter and a slice of populations,
+// and returns the derivative of the vector field with respect to the parameter.
+func ParameterDerivative(parameter ContinuationParameter, x []float64) []float64 {
+	derivative := make([]float64, len(x))
+	if parameter.kind == "r" {
+		derivative[parameter.i] = x[parameter.i]
+	} else {
+		derivative[parameter.i] = x[parameter.i] * x[parameter.j]
+	}
+	return derivative
+}
+
+// NewBranchPoint() takes the ecosystem at a parameter value, its equilibrium and the tangent of the branch,
+// and returns the BranchPoint with the eigenvalues of the Jacobian.
+func NewBranchPoint(ecosystem *Ecosystem, parameter float64, x []float64, tangent float64) BranchPoint {
+	eigenvalues := Eigenvalues(Jacobian(ecosystem, x))
+	sort.Slice(eigenvalues, func(a, b int) bool {
+		if real(eigenvalues[a]) != real(eigenvalues[b]) {
+			return real(eigenvalues[a]) > real(eigenvalues[b])
+		}
+		return imag(eigenvalues[a]) > imag(eigenvalues[b])
+	})
+
+	return BranchPoint{
+		parameter:   parameter,
+		populations: append([]float64(nil), x...),
+		eigenvalues: eigenvalues,
+		stable:      MaxRealPart(eigenvalues) < 0,
+		tangent:     tangent,
+	}
+}
+
+// ExtendedJacobian() returns the (n+1) x (n+1) matrix of the pseudo-arclength system at populations x:
+// the Jacobian with the parameter derivative as last column, and the tangent as last row.
+func ExtendedJacobian(ecosystem *Ecosystem, parameter ContinuationParameter, x, tangent []float64) *mat.Dense {
+	n := len(x)
+	extended := mat.NewDense(n+1, n+1, nil)
+	extended.Slice(0, n, 0, n).(*mat.Dense).Copy(Jacobian(ecosystem, x))
+
+	derivative := ParameterDerivative(parameter, x)
+	for i := 0; i < n; i++ {
+		extended.Set(i, n, derivative[i])
+	}
+	for j := 0; j <= n; j++ {
+		extended.Set(n, j, tangent[j])
+	}
+
+	return extended
+}
+
+// BranchTangent() returns the unit tangent of the branch at populations x, oriented like the previous tangent:
+// the solution t of J_ext t = (0, ..., 0, 1) with the previous tangent as last row of J_ext, normalized.
+func BranchTangent(ecosystem *Ecosystem, parameter ContinuationParameter, x, previous []float64) ([]float64, bool) {
+	n := len(x)
+	rhs := mat.NewVecDense(n+1, nil)
+	rhs.SetVec(n, 1)
+
+	var t mat.VecDense
+	if err := t.SolveVec(ExtendedJacobian(ecosystem, parameter, x, previous), rhs); err != nil {
+		return nil, false
+	}
+
+	norm := mat.Norm(&t, 2)
+	tangent := make([]float64, n+1)
+	for k := range tangent {
+		tangent[k] = t.AtVec(k) / norm
+	}
+
+	return tangent, true
+}
+
+// CorrectEquilibrium() takes the ecosystem, a predicted point y = (x, parameter value) and the tangent of the predictor.
+// It solves f(x, parameter) = 0 together with tangent · (y - prediction) = 0 by Newton's method,
+// and returns the corrected point, whether Newton's method converged, and the number of iterations it took.
+func CorrectEquilibrium(ecosystem *Ecosystem, parameter ContinuationParameter, prediction, tangent []float64) ([]float64, bool, int) {
+	n := len(prediction) - 1
+	y := append([]float64(nil), prediction...)
+
+	for iteration := 1; iteration <= 20; iteration++ {
+		current := SetParameter(ecosystem, parameter, y[n])
+		f := VectorField(current, y[:n])
+
+		residual := mat.NewVecDense(n+1, nil)
+		for i := 0; i < n; i++ {
+			residual.SetVec(i, -f[i])
+		}
+		arclength := 0.0
+		for k := range y {
+			arclength += tangent[k] * (y[k] - prediction[k])
+		}
+		residual.SetVec(n, -arclength)
+
+		var delta mat.VecDense
+		if err := delta.SolveVec(ExtendedJacobian(current, parameter, y[:n], tangent), residual); err != nil {
+			return y, false, iteration
+		}
+
+		for k := range y {
+			y[k] += delta.AtVec(k)
+		}
+		if mat.Norm(&delta, 2) < 1e-10 {
+			return y, true, iteration
+		}
+	}
+
+	return y, false, 20
+}
+
+// ContinueBranch() takes the ecosystem, an equilibrium x0 at its current parameter value, the continuation settings
+// and a direction (+1 to start with an increasing parameter, -1 decreasing). It follows the branch of equilibria
+// through x0 with pseudo-arclength continuation: an Euler predictor along the tangent, then a Newton corrector
+// on the hyperplane orthogonal to it, adapting the step to how fast the corrector converges.
+// It returns the points of the branch, starting at x0.
+func ContinueBranch(ecosystem *Ecosystem, x0 []float64, settings ContinuationSettings, direction float64) []BranchPoint {
+	parameter := settings.parameter
+	n := len(x0)
+
+	// the first tangent is oriented along the parameter
+	y := append(append([]float64(nil), x0...), ParameterValue(ecosystem, parameter))
+	start := make([]float64, n+1)
+	start[n] = direction
+	tangent, ok := BranchTangent(ecosystem, parameter, x0, start)
+	if !ok {
+		panic("Error: the starting equilibrium is singular, so the branch cannot be followed.")
+	}
+
+	branch := []BranchPoint{NewBranchPoint(ecosystem, y[n], x0, tangent[n])}
+	step := settings.step
+
+	for len(branch) < settings.maxPoints {
+		prediction := make([]float64, n+1)
+		for k := range y {
+			prediction[k] = y[k] + step*tangent[k]
+		}
+
+		corrected, converged, iterations := CorrectEquilibrium(ecosystem, parameter, prediction, tangent)
+		if !converged {
+			step /= 2
+			if step < 1e-8 {
+				fmt.Println("Continuation stopped: the corrector does not converge.")
+				break
+			}
+			continue
+		}
+
+		current := SetParameter(ecosystem, parameter, corrected[n])
+		newTangent, ok := BranchTangent(current, parameter, corrected[:n], tangent)
+		if !ok {
+			fmt.Println("Continuation stopped: singular branch point.")
+			break
+		}
+
+		y, tangent = corrected, newTangent
+		branch = append(branch, NewBranchPoint(current, y[n], y[:n], tangent[n]))
+
+		if y[n] < settings.minValue || y[n] > settings.maxValue {
+			break
+		}
+		if mat.Norm(mat.NewVecDense(n, y[:n]), math.Inf(1)) > 1e6 {
+			fmt.Println("Continuation stopped: the equilibrium diverges.")
+			break
+		}
+		if iterations <= 3 {
+			step = math.Min(1.5*step, settings.maxStep)
+		}
+	}
+
+	if len(branch) == settings.maxPoints {
+		fmt.Println("Continuation stopped after", settings.maxPoints, "points; increase -points or -maxstep to go further.")
+	}
+
+	return branch
+}
+
+// FullBranch() follows the branch through x0 in both directions, and returns its points in order of arclength.
+func FullBranch(ecosystem *Ecosystem, x0 []float64, settings ContinuationSettings) []BranchPoint {
+	backward := ContinueBranch(ecosystem, x0, settings, -1)
+	forward := ContinueBranch(ecosystem, x0, settings, 1)
+
+	// the backward points are reversed, so their tangents are too
+	branch := make([]BranchPoint, 0, len(backward)+len(forward)-1)
+	for k := len(backward) - 1; k > 0; k-- {
+		point := backward[k]
+		point.tangent = -point.tangent
+		branch = append(branch, point)
+	}
+	return append(branch, forward...)
+}
+
+// hopfTest() returns the largest real part of the complex eigenvalues of a branch point, or NaN if all are real.
+// It changes sign where a pair of complex eigenvalues crosses the imaginary axis.
+func hopfTest(eigenvalues []complex128) float64 {
+	test := math.NaN()
+	for _, value := range eigenvalues {
+		if math.Abs(imag(value)) > 1e-9 && (math.IsNaN(test) || real(value) > test) {
+			test = real(value)
+		}
+	}
+	return test
+}
+
+// determinantSign() returns the sign of the product of the eigenvalues, which changes where a real eigenvalue crosses 0.
+func determinantSign(eigenvalues []complex128) float64 {
+	product := complex(1, 0)
+	for _, value := range eigenvalues {
+		product *= value
+	}
+	return math.Copysign(1, real(product))
+}
+
+// EquilibriumNear() takes the ecosystem at a parameter value and a guess of its equilibrium,
+// and returns the equilibrium found from the guess by Newton's method on the vector field.
+func EquilibriumNear(ecosystem *Ecosystem, guess []float64) ([]float64, bool) {
+	n := len(guess)
+	x := append([]float64(nil), guess...)
+
+	for iteration := 0; iteration < 50; iteration++ {
+		f := VectorField(ecosystem, x)
+		rhs := mat.NewVecDense(n, nil)
+		for i := range f {
+			rhs.SetVec(i, -f[i])
+		}
+
+		var delta mat.VecDense
+		if err := delta.SolveVec(Jacobian(ecosystem, x), rhs); err != nil {
+			return x, false
+		}
+		for i := range x {
+			x[i] += delta.AtVec(i)
+		}
+		if mat.Norm(&delta, 2) < 1e-12 {
+			return x, true
+		}
+	}
+
+	return x, false
+}
+
+// LocateBifurcation() takes the ecosystem, a test function of the eigenvalues and two branch points on either side
+// of a sign change of the test function. It bisects the parameter between them, finding the equilibrium at every
+// midpoint by Newton's method, and returns the parameter value and the equilibrium where the test function vanishes.
+func LocateBifurcation(ecosystem *Ecosystem, parameter ContinuationParameter, test func([]complex128) float64, before, after BranchPoint) (float64, []float64) {
+	low, high := before.parameter, after.parameter
+	lowSign := math.Signbit(test(before.eigenvalues))
+	lowX, highX := before.populations, after.populations
+	x := lowX
+
+	for iteration := 0; iteration < 60 && math.Abs(high-low) > 1e-12; iteration++ {
+		middle := (low + high) / 2
+		guess := make([]float64, len(x))
+		for i := range guess {
+			guess[i] = (lowX[i] + highX[i]) / 2
+		}
+
+		current := SetParameter(ecosystem, parameter, middle)
+		equilibrium, ok := EquilibriumNear(current, guess)
+		if !ok {
+			break
+		}
+		x = equilibrium
+
+		if math.Signbit(test(Eigenvalues(Jacobian(current, x)))) == lowSign {
+			low, lowX = middle, x
+		} else {
+			high, highX = middle, x
+		}
+	}
+
+	return (low + high) / 2, x
+}
+
+// HopfFrequency() takes the ecosystem and an equilibrium, and returns the largest angular frequency
+// of a pair of complex eigenvalues of the Jacobian on the imaginary axis, or 0 if there is none.
+// At a Hopf bifurcation, the limit cycle emerges with period 2π / frequency.
+func HopfFrequency(ecosystem *Ecosystem, x []float64) float64 {
+	frequency := 0.0
+	for _, value := range Eigenvalues(Jacobian(ecosystem, x)) {
+		if math.Abs(real(value)) < 1e-6 && math.Abs(imag(value)) > 1e-6 {
+			frequency = math.Max(frequency, math.Abs(imag(value)))
+		}
+	}
+	return frequency
+}
+
+// DetectBifurcations() takes the ecosystem and the points of a branch, and returns the bifurcations between them:
+// a fold where the branch turns back in the parameter, a Hopf bifurcation where a complex pair of eigenvalues
+// crosses the imaginary axis, and a transcritical bifurcation where a real eigenvalue crosses 0 away from a fold,
+// which for LV equilibria happens where the branch crosses another one on the boundary (a population going through 0).
+func DetectBifurcations(ecosystem *Ecosystem, parameter ContinuationParameter, branch []BranchPoint) []Bifurcation {
+	bifurcations := make([]Bifurcation, 0)
+
+	for k := 0; k+1 < len(branch); k++ {
+		before, after := branch[k], branch[k+1]
+
+		if math.Signbit(before.tangent) != math.Signbit(after.tangent) {
+			// the turning point is where the tangent's parameter component is 0
+			fraction := before.tangent / (before.tangent - after.tangent)
+			x := make([]float64, len(before.populations))
+			for i := range x {
+				x[i] = before.populations[i] + fraction*(after.populations[i]-before.populations[i])
+			}
+			value := before.parameter + fraction*(after.parameter-before.parameter)
+			bifurcations = append(bifurcations, Bifurcation{kind: "fold", parameter: value, populations: x, point: k})
+			continue
+		}
+
+		if determinantSign(before.eigenvalues) != determinantSign(after.eigenvalues) {
+			value, x := LocateBifurcation(ecosystem, parameter, func(e []complex128) float64 { return determinantSign(e) }, before, after)
+			bifurcations = append(bifurcations, Bifurcation{kind: "transcritical", parameter: value, populations: x, point: k})
+		}
+
+		hopfBefore, hopfAfter := hopfTest(before.eigenvalues), hopfTest(after.eigenvalues)
+		if !math.IsNaN(hopfBefore) && !math.IsNaN(hopfAfter) && math.Signbit(hopfBefore) != math.Signbit(hopfAfter) {
+			// the test function also jumps where a complex pair turns real, so the crossing is checked
+			value, x := LocateBifurcation(ecosystem, parameter, hopfTest, before, after)
+			if HopfFrequency(SetParameter(ecosystem, parameter, value), x) > 0 {
+				bifurcations = append(bifurcations, Bifurcation{kind: "hopf", parameter: value, populations: x, point: k})
+			}
+		}
+	}
+
+	return bifurcations
+}
+
+// WriteBranchCSV() writes the points of a branch to a CSV file: the parameter, the equilibrium populations,
+// the real and imaginary parts of every eigenvalue, the stability and the bifurcation found after each point, if any.
+func WriteBranchCSV(branch []BranchPoint, bifurcations []Bifurcation, species []*Specie, parameter ContinuationParameter, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Point", ParameterName(parameter)}
+	for _, specie := range species {
+		header = append(header, SpeciesName(specie))
+	}
+	for k := range species {
+		header = append(header, "Re eigenvalue "+strconv.Itoa(k), "Im eigenvalue "+strconv.Itoa(k))
+	}
+	header = append(header, "Stable", "Bifurcation")
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	// bifurcations are listed on the row of the point before them
+	labels := make(map[int][]string)
+	for _, bifurcation := range bifurcations {
+		labels[bifurcation.point] = append(labels[bifurcation.point], bifurcation.kind+"@"+strconv.FormatFloat(bifurcation.parameter, 'g', 10, 64))
+	}
+
+	for k, point := range branch {
+		row := []string{strconv.Itoa(k), strconv.FormatFloat(point.parameter, 'f', -1, 64)}
+		for _, x := range point.populations {
+			row = append(row, strconv.FormatFloat(x, 'f', -1, 64))
+		}
+		for _, value := range point.eigenvalues {
+			row = append(row, strconv.FormatFloat(real(value), 'g', -1, 64), strconv.FormatFloat(imag(value), 'g', -1, 64))
+		}
+		row = append(row, strconv.FormatBool(point.stable), strings.Join(labels[k], " "))
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// DrawBranch() takes the points of a branch, its bifurcations and the species, and returns a Plot of the equilibrium
+// population of every species against the parameter, solid where the equilibrium is stable and dotted where it is not,
+// with the bifurcations marked by their initial (F, T or H).
+func DrawBranch(branch []BranchPoint, bifurcations []Bifurcation, species []*Specie, parameter ContinuationParameter) *Plot {
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMin, yMax := math.Inf(1), math.Inf(-1)
+	for _, point := range branch {
+		xMin, xMax = math.Min(xMin, point.parameter), math.Max(xMax, point.parameter)
+		for _, x := range point.populations {
+			yMin, yMax = math.Min(yMin, x), math.Max(yMax, x)
+		}
+	}
+	if xMax == xMin {
+		xMax = xMin + 1
+	}
+	if yMax == yMin {
+		yMax = yMin + 1
+	}
+
+	plot := NewPlot(600, 400, xMin, xMax, yMin, yMax, len(species))
+
+	colors := make([]color.Color, len(species))
+	labels := make([]string, len(species))
+	for i, specie := range species {
+		colors[i] = CategoryColor(i)
+		labels[i] = SpeciesName(specie)
+	}
+
+	for k := 0; k+1 < len(branch); k++ {
+		for i := range species {
+			if branch[k].stable {
+				PlotLine(plot, branch[k].parameter, branch[k].populations[i], branch[k+1].parameter, branch[k+1].populations[i], colors[i])
+			} else {
+				PlotPoint(plot, branch[k].parameter, branch[k].populations[i], 2, colors[i])
+			}
+		}
+	}
+
+	for _, bifurcation := range bifurcations {
+		for _, x := range bifurcation.populations {
+			px, py := PlotPosition(plot, bifurcation.parameter, x)
+			PlotPoint(plot, bifurcation.parameter, x, 6, color.Black)
+			DrawText(plot.img, px+5, py-2*glyphHeight-3, strings.ToUpper(bifurcation.kind[:1]), color.Black, 2)
+		}
+	}
+
+	DrawAxes(plot, "Equilibrium branch", ParameterName(parameter), "Equilibrium population")
+	DrawPlotLegend(plot, labels, colors)
+
+	return plot
+}
+
+// ContinuationCommand follows the branch of equilibria of a scenario file or preset as one parameter changes,
+// and writes it to ./output/<name>_branch.csv and ./output/<name>_branch.png.
+func ContinuationCommand(args []string) {
+	flags := flag.NewFlagSet("continuation", flag.ExitOnError)
+	key := flags.String("param", "r:0", "parameter to vary: r:i for a growth rate, a:i:j for the effect of species j on species i")
+	minValue := flags.Float64("min", math.Inf(-1), "smallest value of the parameter")
+	maxValue := flags.Float64("max", math.Inf(1), "largest value of the parameter")
+	step := flags.Float64("step", 0.01, "initial arclength step")
+	maxStep := flags.Float64("maxstep", 0.1, "largest arclength step")
+	maxPoints := flags.Int("points", 2000, "largest number of points in each direction")
+	start := flags.String("start", "interior", "starting equilibrium: interior, or simulate to take the end of a simulation")
+	name := flags.String("name", "", "name of the output files (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the continuation command takes the name of a scenario file or preset.")
+	}
+	if *minValue >= *maxValue {
+		panic("Error: the parameter range is empty.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	ecosystem := BuildEcosystem(scenario)
+	RequireContinuous(ecosystem, "continuation")
+	if ecosystem.delay != nil {
+		fmt.Println("Delays do not change the equilibria and are ignored by the continuation.")
+	}
+
+	settings := ContinuationSettings{
+		parameter: ParseContinuationParameter(*key, len(ecosystem.species)),
+		minValue:  *minValue,
+		maxValue:  *maxValue,
+		step:      *step,
+		maxStep:   *maxStep,
+		maxPoints: *maxPoints,
+	}
+	if ecosystem.switching != nil && settings.parameter.kind == "a" {
+		panic("Error: the continuation of an interaction coefficient does not support prey switching, whose attack rates depend on every coefficient of the predator.")
+	}
+
+	// find the starting equilibrium
+	var guess []float64
+	if *start == "simulate" {
+		timePoints := SimulateWithSettings(ecosystem, ScenarioSettings(scenario))
+		guess = make([]float64, len(ecosystem.species))
+		for _, specie := range timePoints[len(timePoints)-1].species {
+			guess[specie.index] = specie.population
+		}
+	} else {
+		interior, ok := InteriorEquilibrium(ecosystem)
+		if !ok {
+			panic("Error: no interior equilibrium to start from; try -start simulate.")
+		}
+		guess = interior
+	}
+	x0, ok := EquilibriumNear(ecosystem, guess)
+	if !ok {
+		panic("Error: Newton's method did not converge to the starting equilibrium.")
+	}
+
+	fmt.Println("Following the branch of", ParameterName(settings.parameter), "from", ParameterValue(ecosystem, settings.parameter), "...")
+	branch := FullBranch(ecosystem, x0, settings)
+	bifurcations := DetectBifurcations(ecosystem, settings.parameter, branch)
+
+	fmt.Println("Branch of", len(branch), "points, from", branch[0].parameter, "to", branch[len(branch)-1].parameter)
+	for _, bifurcation := range bifurcations {
+		fmt.Printf("%s bifurcation at %s = %.8g:", bifurcation.kind, ParameterName(settings.parameter), bifurcation.parameter)
+		for i, x := range bifurcation.populations {
+			fmt.Printf(" %s=%.4g", SpeciesName(ecosystem.species[i]), x)
+		}
+		if bifurcation.kind == "hopf" {
+			// the period of the limit cycle emerging at the Hopf point
+			frequency := HopfFrequency(SetParameter(ecosystem, settings.parameter, bifurcation.parameter), bifurcation.populations)
+			fmt.Printf(" (period %.4g)", 2*math.Pi/frequency)
+		}
+		fmt.Println()
+	}
+
+	if *name == "" {
+		*name = ScenarioSettings(scenario).name
+	}
+	filename := "./output/" + *name + "_branch"
+	WriteBranchCSV(branch, bifurcations, ecosystem.species, settings.parameter, filename+".csv")
+	SavePNG(DrawBranch(branch, bifurcations, ecosystem.species, settings.parameter).img, filename+".png")
+	fmt.Println("Branch written to " + filename + ".csv and .png")
+}
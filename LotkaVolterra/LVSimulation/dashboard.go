@@ -0,0 +1,288 @@
+package main
+
+// The terminal handling of this file (Dashboard, StartDashboard(), stty(), UpdateDashboard() and DrawDashboard()) is
+// the same as in WrightFisher/WrightFisherSimulation/dashboard.go. The two programs are separate Go modules that share
+// no package, so a fix to one must be copied to the other. Only the live views differ: Sparkline() here scales every
+// species to its own range, while the Wright-Fisher one draws allele frequencies in a fixed range.
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// settings of the terminal dashboard
+const (
+	dashboardWidth      = 60                     // characters of the progress bar and of the sparklines
+	dashboardRefresh    = 200 * time.Millisecond // time between two redraws
+	dashboardMaxSpecies = 20                     // species shown with a sparkline; the others are counted
+)
+
+// sparkLevels are the characters of a sparkline, from the lowest to the highest value.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Dashboard is a live view of a running simulation in the terminal, with the keys that pause, resume and abort it.
+type Dashboard struct {
+	title       string
+	total       int // number of steps of the run
+	start       time.Time
+	pausedSince time.Time     // zero while running
+	pausedFor   time.Duration // total time spent paused, left out of the ETA
+	lastDraw    time.Time
+	keys        chan byte
+	restore     func() // restores the terminal settings, or nil if they were not changed
+}
+
+// StartDashboard() takes a title and the number of steps of a run, and returns a Dashboard reading the keys pressed.
+// The terminal is put in cbreak mode so that single keys are read without Enter; if this fails (e.g. the input is not
+// a terminal), the keys are still read from the input, followed by Enter.
+func StartDashboard(title string, total int) *Dashboard {
+	dashboard := &Dashboard{
+		title: title,
+		total: total,
+		start: time.Now(),
+		keys:  make(chan byte, 16),
+	}
+
+	saved, err := stty("-g")
+	if err == nil {
+		if _, err := stty("cbreak", "-echo"); err == nil {
+			dashboard.restore = func() { stty(strings.TrimSpace(saved)) }
+		}
+	}
+
+	// the reader is left blocked on the input when the run ends, which is fine as the program ends soon after
+	go func() {
+		buffer := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buffer)
+			if err != nil {
+				return
+			}
+			if n == 1 {
+				dashboard.keys <- buffer[0]
+			}
+		}
+	}()
+
+	fmt.Print("\033[?25l") // hide the cursor
+	return dashboard
+}
+
+// stty() runs stty on the terminal of the standard input with the given arguments, and returns its output.
+func stty(args ...string) (string, error) {
+	command := exec.Command("stty", args...)
+	command.Stdin = os.Stdin
+	output, err := command.Output()
+	return string(output), err
+}
+
+// StopDashboard() restores the terminal settings changed by StartDashboard().
+func StopDashboard(dashboard *Dashboard) {
+	if dashboard.restore != nil {
+		dashboard.restore()
+	}
+	fmt.Print("\033[?25h") // show the cursor
+}
+
+// UpdateDashboard() takes a Dashboard, the number of steps done and a function returning the lines of the live view.
+// At most every dashboardRefresh, it handles the keys pressed since the last update and redraws the view:
+// p (or space) pauses the run until r or p is pressed, and q aborts it. It returns false if the run was aborted.
+func UpdateDashboard(dashboard *Dashboard, step int, view func() []string) bool {
+	if time.Since(dashboard.lastDraw) < dashboardRefresh && step < dashboard.total {
+		return true
+	}
+
+	for {
+		select {
+		case key := <-dashboard.keys:
+			switch key {
+			case 'p', 'P', ' ':
+				if dashboard.pausedSince.IsZero() {
+					dashboard.pausedSince = time.Now()
+				} else {
+					ResumeDashboard(dashboard)
+				}
+			case 'r', 'R':
+				ResumeDashboard(dashboard)
+			case 'q', 'Q':
+				ResumeDashboard(dashboard)
+				DrawDashboard(dashboard, step, view(), "Aborted")
+				return false
+			}
+			continue
+		default:
+		}
+
+		if dashboard.pausedSince.IsZero() {
+			DrawDashboard(dashboard, step, view(), "Running")
+			return true
+		}
+
+		// wait for a key while paused
+		DrawDashboard(dashboard, step, view(), "Paused")
+		time.Sleep(dashboardRefresh)
+	}
+}
+
+// ResumeDashboard() ends the pause of a Dashboard, if it is paused.
+func ResumeDashboard(dashboard *Dashboard) {
+	if !dashboard.pausedSince.IsZero() {
+		dashboard.pausedFor += time.Since(dashboard.pausedSince)
+		dashboard.pausedSince = time.Time{}
+	}
+}
+
+// DrawDashboard() clears the terminal and draws the title of a Dashboard, a progress bar with the elapsed time and ETA,
+// its status with the keys, and the lines of the live view.
+func DrawDashboard(dashboard *Dashboard, step int, lines []string, status string) {
+	dashboard.lastDraw = time.Now()
+
+	// the time spent paused counts neither as elapsed nor for the ETA
+	elapsed := time.Since(dashboard.start) - dashboard.pausedFor
+	if !dashboard.pausedSince.IsZero() {
+		elapsed -= time.Since(dashboard.pausedSince)
+	}
+	eta := "?"
+	if step > 0 {
+		eta = (time.Duration(float64(elapsed) / float64(step) * float64(dashboard.total-step))).Round(time.Second).String()
+	}
+
+	fraction := float64(step) / float64(max(1, dashboard.total))
+	filled := int(fraction * dashboardWidth)
+
+	var view strings.Builder
+	view.WriteString("\033[H\033[J")
+	fmt.Fprintln(&view, dashboard.title)
+	fmt.Fprintf(&view, "[%s%s] %5.1f%%  %d/%d\n", strings.Repeat("#", filled), strings.Repeat("-", dashboardWidth-filled), 100*fraction, step, dashboard.total)
+	fmt.Fprintf(&view, "Elapsed %s  ETA %s\n", elapsed.Round(time.Second), eta)
+	fmt.Fprintf(&view, "%s  (p pause, r resume, q abort and save)\n\n", status)
+	for _, line := range lines {
+		fmt.Fprintln(&view, line)
+	}
+	fmt.Print(view.String())
+}
+
+// Sparkline() takes a slice of values, and returns a line of one character per value whose height shows the value
+// between the minimum and the maximum of the slice.
+func Sparkline(values []float64) string {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+
+	line := make([]rune, len(values))
+	for k, v := range values {
+		level := 0
+		if high > low {
+			level = int((v - low) / (high - low) * float64(len(sparkLevels)-1))
+		}
+		line[k] = sparkLevels[max(0, min(level, len(sparkLevels)-1))]
+	}
+	return string(line)
+}
+
+// SimulateWithDashboard() takes an initial *Ecosystem object and simulation settings. It simulates the ecosystem like
+// SimulateWithSettings() while a Dashboard shows the progress and a sparkline of every species over the run so far.
+// If the run is aborted, it returns the time points simulated until then.
+func SimulateWithDashboard(initialEcosystem *Ecosystem, settings SimulationSettings) []*Ecosystem {
+
+	numGens := settings.numGens
+	sampleEvery := max(1, settings.sampleEvery)
+	species := initialEcosystem.species
+	shown := min(len(species), dashboardMaxSpecies)
+
+	// one sparkline column every column generations, so that the sparklines span the whole run when it ends
+	column := max(1, numGens/dashboardWidth)
+	history := make([][]float64, shown)
+	nameWidth := 0
+	for i := 0; i < shown; i++ {
+		history[i] = []float64{species[i].population}
+		nameWidth = max(nameWidth, len(SpeciesName(species[i])))
+	}
+
+	// the continuous equations, with or without delays, and the discrete-generation models advance one generation
+	// at a time, with their populations in pop
+	var pop []float64
+	var step func()
+	var snapshot func() *Ecosystem
+	switch {
+	case initialEcosystem.delay != nil:
+		state := InitializeDelayState(initialEcosystem, settings.time, settings.history)
+		pop = state.pop
+		step = func() { StepDelayState(state) }
+		snapshot = func() *Ecosystem { return state.past[len(state.past)-1] }
+	case initialEcosystem.model != "":
+		state := InitializeDiscreteState(initialEcosystem)
+		pop = state.pop
+		step = func() { StepDiscreteState(state) }
+		snapshot = func() *Ecosystem { return EcosystemFromDiscreteState(state) }
+	default:
+		state := InitializeLVState(initialEcosystem, settings.time)
+		pop = state.pop
+		step = func() { StepLVState(state) }
+		snapshot = func() *Ecosystem { return EcosystemFromState(state) }
+	}
+
+	view := func() []string {
+		lines := make([]string, 0, shown+1)
+		for i := 0; i < shown; i++ {
+			lines = append(lines, fmt.Sprintf("%-*s %-*s %.4g", nameWidth, SpeciesName(species[i]), dashboardWidth+1, Sparkline(history[i]), pop[species[i].index]))
+		}
+		if shown < len(species) {
+			lines = append(lines, fmt.Sprintf("... and %d more species", len(species)-shown))
+		}
+		return lines
+	}
+
+	dashboard := StartDashboard("Lotka-Volterra simulation "+settings.name, numGens)
+	defer StopDashboard(dashboard)
+
+	timePoints := make([]*Ecosystem, 0, numGens/sampleEvery+1)
+	timePoints = append(timePoints, initialEcosystem)
+	for generation := 1; generation <= numGens; generation++ {
+		step()
+		if generation%sampleEvery == 0 {
+			timePoints = append(timePoints, snapshot())
+		}
+		if generation%column == 0 {
+			for i := range history {
+				history[i] = append(history[i], pop[species[i].index])
+			}
+		}
+
+		if !UpdateDashboard(dashboard, generation, view) {
+			fmt.Printf("\nRun aborted at generation %d; saving the partial output.\n", generation)
+			return timePoints
+		}
+	}
+	fmt.Println()
+
+	return timePoints
+}
+
+// DashboardCommand simulates a scenario file or preset like the scenario command, with a live dashboard in the terminal
+// showing the progress of the run and a sparkline of every species. The run can be paused, resumed and aborted;
+// an aborted run still writes its output up to the generation it reached.
+func DashboardCommand(args []string) {
+	flags := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	numGens := flags.Int("gens", 0, "number of generations (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the dashboard command takes the name of a scenario file or preset.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	settings := ScenarioSettings(scenario)
+	if *numGens > 0 {
+		settings.numGens = *numGens
+	}
+	settings.dashboard = true
+
+	RunSimulation(BuildEcosystem(scenario), settings)
+}
@@ -8,9 +8,37 @@ type Ecosystem struct {
 	species     []*Specie
 	interaction mat.Matrix
 	deathGrowth mat.Matrix
+	// stageTransfer holds the linear flows between the stages of stage-structured species
+	// (maturation and reproduction), added as stageTransfer * p to the population change; nil if there are none
+	stageTransfer mat.Matrix
+	// delay holds the time delay τ_ij of every interaction term, so that species i responds to x_j(t - τ_ij);
+	// nil if the interactions act without delay
+	delay mat.Matrix
+	// model names the discrete-generation model that replaces the LV equations (see discreteModels);
+	// empty for the continuous model
+	model string
+	// higherOrder holds the third-order interactions b_ijk, adding Σ_jk b_ijk x_j x_k to the per-capita growth rate
+	// of species i; nil if the species only interact in pairs
+	higherOrder *HigherOrderTensor
+	// switching reallocates the attack rates of predators towards their most abundant prey as the simulation runs;
+	// nil if the interaction matrix stays fixed
+	switching *PreySwitching
 }
 
 type Specie struct {
 	population float64
 	index      int
+	name       string
+	color      []uint8 // RGB color used for drawing; nil means a random color is chosen
+	role       string  // "producer" or "consumer"
+	stage      string  // life stage such as "juvenile" or "adult"; empty for species without stages
+	trait      float64 // continuous trait (e.g. log body size) of eco-evolutionary runs; 0 otherwise
+}
+
+// SpeciesMetadata holds the descriptive attributes of a species that are given when an ecosystem is initialized.
+type SpeciesMetadata struct {
+	name  string
+	color []uint8
+	role  string
+	stage string
 }
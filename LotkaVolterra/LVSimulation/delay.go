@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// HistoryFunction gives the population of the species with the given index at a time t < 0, before the simulation starts.
+// Delay differential equations need it because the delayed interactions look back past the initial time.
+type HistoryFunction func(t float64, index int) float64
+
+// ConstantHistory() takes the initial *Ecosystem object, and returns a HistoryFunction that keeps every species
+// at its initial population for all t < 0.
+func ConstantHistory(initialEcosystem *Ecosystem) HistoryFunction {
+	pop := make([]float64, len(initialEcosystem.species))
+	for _, specie := range initialEcosystem.species {
+		pop[specie.index] = specie.population
+	}
+
+	return func(t float64, index int) float64 {
+		return pop[index]
+	}
+}
+
+// ReadHistoryCSV() takes the name of a CSV file with a header row, a first column of times (t <= 0)
+// and one population column per species in the order of the ecosystem.
+// It returns a HistoryFunction interpolating linearly between the given times,
+// and holding the first and last rows constant outside of them.
+func ReadHistoryCSV(filename string) HistoryFunction {
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	if len(records) < 2 {
+		panic("Error: history file " + filename + " has no data rows.")
+	}
+
+	// skip the header row, and parse every data row
+	rows := make([][]float64, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make([]float64, len(record))
+		for i, field := range record {
+			row[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				panic(err)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(a, b int) bool { return rows[a][0] < rows[b][0] })
+
+	return func(t float64, index int) float64 {
+		// the first column holds the times, so species index i is in column i + 1
+		column := index + 1
+		if column >= len(rows[0]) {
+			panic("Error: history file " + filename + " has no column for species " + strconv.Itoa(index))
+		}
+
+		if t <= rows[0][0] {
+			return rows[0][column]
+		}
+		for k := 1; k < len(rows); k++ {
+			if t <= rows[k][0] {
+				fraction := (t - rows[k-1][0]) / (rows[k][0] - rows[k-1][0])
+				return rows[k-1][column] + fraction*(rows[k][column]-rows[k-1][column])
+			}
+		}
+		return rows[len(rows)-1][column]
+	}
+}
+
+// SimulateDelayEcosystem() takes the initial *Ecosystem object, a number of generations, a time interval and a HistoryFunction
+// (nil for a constant history). It simulates the delayed LV equations dx_i/dt = x_i (r_i + Σ_j a_ij x_j(t - τ_ij))
+// with the method of steps: every step only needs populations that are already known, either from the history
+// or from the time points simulated so far, which act as the history buffer.
+// It returns numGens + 1 *Ecosystem pointers, like SimulateEcosystem.
+func SimulateDelayEcosystem(initialEcosystem *Ecosystem, numGens int, time float64, history HistoryFunction) []*Ecosystem {
+	if history == nil {
+		history = ConstantHistory(initialEcosystem)
+	}
+
+	timePoints := make([]*Ecosystem, numGens+1)
+	timePoints[0] = initialEcosystem
+
+	for i := 1; i < numGens+1; i++ {
+		timePoints[i] = UpdateDelayEcosystem(timePoints[:i], 0, time, history)
+	}
+
+	return timePoints
+}
+
+// SimulateDelayEcosystemSampled() takes the initial *Ecosystem object, a number of generations, a time interval,
+// a HistoryFunction (nil for a constant history) and a sampling interval. It simulates the delayed ecosystem like
+// SimulateDelayEcosystem(), but steps a DelayState and only keeps every sampleEvery-th time point,
+// so that long delayed runs do not store every step. It returns the time points 0, sampleEvery, 2*sampleEvery, ... up to numGens.
+func SimulateDelayEcosystemSampled(initialEcosystem *Ecosystem, numGens int, time float64, history HistoryFunction, sampleEvery int) []*Ecosystem {
+	if sampleEvery <= 0 {
+		panic("Error: nonpositive number given as sampling interval.")
+	}
+
+	timePoints := make([]*Ecosystem, 0, numGens/sampleEvery+1)
+	timePoints = append(timePoints, initialEcosystem)
+
+	state := InitializeDelayState(initialEcosystem, time, history)
+	for i := 1; i < numGens+1; i++ {
+		StepDelayState(state)
+		if i%sampleEvery == 0 {
+			timePoints = append(timePoints, state.past[len(state.past)-1])
+		}
+	}
+
+	return timePoints
+}
+
+// DelayState holds the recent time points of a delayed simulation, as many as its largest delay needs,
+// so that long runs do not keep every time point like SimulateDelayEcosystem().
+type DelayState struct {
+	time    float64
+	history HistoryFunction
+	past    []*Ecosystem // the time points from generation first on; the last one is the current one
+	first   int
+	keep    int       // number of time points covering the largest delay, with a margin for the interpolation
+	pop     []float64 // populations of the current time point, indexed by species index
+}
+
+// InitializeDelayState() takes the initial *Ecosystem object, a time interval and a HistoryFunction
+// (nil for a constant history), and returns its DelayState.
+func InitializeDelayState(initialEcosystem *Ecosystem, time float64, history HistoryFunction) *DelayState {
+	if history == nil {
+		history = ConstantHistory(initialEcosystem)
+	}
+
+	state := &DelayState{
+		time:    time,
+		history: history,
+		past:    []*Ecosystem{initialEcosystem},
+		keep:    int(math.Ceil(mat.Max(initialEcosystem.delay)/time)) + 3,
+		pop:     make([]float64, len(initialEcosystem.species)),
+	}
+	for _, specie := range initialEcosystem.species {
+		state.pop[specie.index] = specie.population
+	}
+
+	return state
+}
+
+// StepDelayState() advances a DelayState by one time interval with UpdateDelayEcosystem(),
+// and drops the time points that no delay reaches back to anymore.
+func StepDelayState(state *DelayState) {
+	newEcosystem := UpdateDelayEcosystem(state.past, state.first, state.time, state.history)
+	state.past = append(state.past, newEcosystem)
+	for _, specie := range newEcosystem.species {
+		state.pop[specie.index] = specie.population
+	}
+
+	// the oldest time points are dropped in batches, so that every step does not move the buffer
+	if len(state.past) >= 2*state.keep {
+		dropped := len(state.past) - state.keep
+		state.past = append(state.past[:0], state.past[dropped:]...)
+		state.first += dropped
+	}
+}
+
+// UpdateDelayEcosystem() takes the time points simulated so far from generation first on, the time interval and
+// a HistoryFunction, and returns a new Ecosystem object one time interval after the last time point.
+func UpdateDelayEcosystem(past []*Ecosystem, first int, time float64, history HistoryFunction) *Ecosystem {
+	currEcosystem := past[len(past)-1]
+	currTime := float64(first+len(past)-1) * time
+
+	// the time points share the matrices, which do not change during a simulation, like EcosystemFromState()
+	newEcosystem := &Ecosystem{
+		species:       CopySpecies(currEcosystem.species),
+		interaction:   currEcosystem.interaction,
+		deathGrowth:   currEcosystem.deathGrowth,
+		stageTransfer: currEcosystem.stageTransfer,
+		delay:         currEcosystem.delay,
+		model:         currEcosystem.model,
+		higherOrder:   currEcosystem.higherOrder,
+		switching:     currEcosystem.switching,
+	}
+	p := InitializePop(currEcosystem.species)
+
+	// stage flows act on the current populations
+	var stageFlow mat.Dense
+	if currEcosystem.stageTransfer != nil {
+		stageFlow.Mul(currEcosystem.stageTransfer, p)
+	}
+
+	// switching predators choose their prey from the current populations
+	interaction := EffectiveInteraction(currEcosystem, mat.Col(nil, 0, p))
+
+	for _, specie := range newEcosystem.species {
+		i := specie.index
+
+		// per-capita growth rate with every interaction evaluated at its delayed time
+		growth := currEcosystem.deathGrowth.At(i, 0)
+		for j := range currEcosystem.species {
+			a := interaction.At(i, j)
+			if a == 0 {
+				continue
+			}
+			growth += a * DelayedPopulation(past, first, j, currTime-currEcosystem.delay.At(i, j), time, history)
+		}
+		// higher-order interactions act without delay
+		if currEcosystem.higherOrder != nil {
+			growth += HigherOrderTerm(currEcosystem.higherOrder, i, mat.Col(nil, 0, p))
+		}
+
+		change := time * p.At(i, 0) * growth
+		if currEcosystem.stageTransfer != nil {
+			change += time * stageFlow.At(i, 0)
+		}
+
+		// no population goes below 0
+		specie.population = math.Max(0, p.At(i, 0)+change)
+	}
+
+	return newEcosystem
+}
+
+// DelayedPopulation() takes the time points simulated so far from generation first on, a species index, a time t,
+// the time interval and a HistoryFunction. It returns the population of that species at time t, from the history
+// if t < 0, and otherwise interpolated linearly between the two time points around t.
+func DelayedPopulation(past []*Ecosystem, first, index int, t, time float64, history HistoryFunction) float64 {
+	if t < 0 {
+		return history(t, index)
+	}
+
+	position := t/time - float64(first)
+	k := int(math.Floor(position))
+	if k < 0 {
+		panic("Error: a delayed interaction looks back past the time points kept by the simulation.")
+	}
+	if k >= len(past)-1 {
+		return past[len(past)-1].species[index].population
+	}
+
+	fraction := position - float64(k)
+	before := past[k].species[index].population
+	after := past[k+1].species[index].population
+
+	return before + fraction*(after-before)
+}
+
+// SetDelayMatrix() takes the delays of an ecosystem with numSpecies species, given row by row like the interaction matrix
+// of a scenario, and returns the delay matrix. Delays must not be negative.
+func SetDelayMatrix(delays [][]float64, numSpecies int) mat.Matrix {
+	if len(delays) != numSpecies {
+		panic("Error: delay matrix must have one row per species.")
+	}
+
+	delayMatrix := mat.NewDense(numSpecies, numSpecies, nil)
+	for i, row := range delays {
+		if len(row) != numSpecies {
+			panic("Error: delay matrix must be square.")
+		}
+		for j, tau := range row {
+			if tau < 0 {
+				panic("Error: negative number given as delay.")
+			}
+			delayMatrix.Set(i, j, tau)
+		}
+	}
+
+	return delayMatrix
+}
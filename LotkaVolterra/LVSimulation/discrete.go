@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math"
+)
+
+// DiscreteMap computes the populations of the next generation of a discrete-generation model
+// from the populations x of the current one, writing them to next.
+type DiscreteMap func(ecosystem *Ecosystem, x, next []float64)
+
+// discreteModels holds the discrete-generation models that a scenario can use instead of the continuous LV equations.
+// They reuse the growth rates r_i and interaction matrix A of the ecosystem, so that one generation is one breeding season.
+var discreteModels = map[string]DiscreteMap{
+	"ricker":           RickerMap,
+	"beverton-holt":    BevertonHoltMap,
+	"nicholson-bailey": NicholsonBaileyMap,
+	"discrete-lv":      DiscreteLVMap,
+}
+
+// interactionSum() takes a pointer of Ecosystem object, the populations and a species index,
+// and returns Σ_j a_ij x_j, plus Σ_jk b_ijk x_j x_k if the ecosystem has higher-order interactions.
+func interactionSum(ecosystem *Ecosystem, x []float64, i int) float64 {
+	sum := 0.0
+	for j, population := range x {
+		sum += ecosystem.interaction.At(i, j) * population
+	}
+	if ecosystem.higherOrder != nil {
+		sum += HigherOrderTerm(ecosystem.higherOrder, i, x)
+	}
+	return sum
+}
+
+// RickerMap is the multispecies Ricker model x_i' = x_i exp(r_i + Σ_j a_ij x_j). With one species and a_ii = -r/K
+// it is the classic Ricker map x' = x exp(r (1 - x/K)), which goes from a stable equilibrium through period doubling
+// to chaos as r grows beyond 2.
+func RickerMap(ecosystem *Ecosystem, x, next []float64) {
+	for i := range x {
+		next[i] = x[i] * math.Exp(ecosystem.deathGrowth.At(i, 0)+interactionSum(ecosystem, x, i))
+	}
+}
+
+// BevertonHoltMap is the multispecies Beverton-Holt (Leslie-Gower) model x_i' = λ_i x_i / (1 - Σ_j a_ij x_j),
+// with the growth factor λ_i = exp(r_i). It is meant for competitive communities (a_ij <= 0), and panics if
+// positive interactions make a denominator nonpositive.
+func BevertonHoltMap(ecosystem *Ecosystem, x, next []float64) {
+	for i := range x {
+		denominator := 1 - interactionSum(ecosystem, x, i)
+		if denominator <= 0 {
+			panic("Error: nonpositive Beverton-Holt denominator; the model needs competitive interactions.")
+		}
+		next[i] = math.Exp(ecosystem.deathGrowth.At(i, 0)) * x[i] / denominator
+	}
+}
+
+// NicholsonBaileyMap is the Nicholson-Bailey host-parasitoid model, with the consumers as parasitoids and the other
+// species as hosts. A host grows like in the Ricker model, so that it only escapes the parasitoids j with the
+// probability exp(Σ_j a_ij P_j), where -a_ij is the search efficiency of j. Every parasitized host i yields a_ji
+// parasitoids of the next generation, shared between the parasitoids in proportion to their attacks on i.
+// Adult parasitoids do not survive to the next generation, so their growth rates are not used. With one host and
+// one parasitoid it is the classic H' = λ H exp(-a P), P' = c H (1 - exp(-a P)), whose oscillations grow until one
+// species dies out.
+func NicholsonBaileyMap(ecosystem *Ecosystem, x, next []float64) {
+	species := ecosystem.species
+	for j := range next {
+		if species[j].role == "consumer" {
+			next[j] = 0
+		}
+	}
+
+	for i, host := range species {
+		if host.role == "consumer" {
+			continue
+		}
+
+		// total attack rate on the host, and the fraction that escapes it
+		attacks := 0.0
+		for j, parasitoid := range species {
+			if parasitoid.role == "consumer" {
+				attacks -= ecosystem.interaction.At(i, j) * x[j]
+			}
+		}
+		next[i] = x[i] * math.Exp(ecosystem.deathGrowth.At(i, 0)+interactionSum(ecosystem, x, i))
+		if attacks <= 0 {
+			continue
+		}
+
+		parasitized := x[i] * (1 - math.Exp(-attacks))
+		for j, parasitoid := range species {
+			if parasitoid.role == "consumer" {
+				share := -ecosystem.interaction.At(i, j) * x[j] / attacks
+				next[j] += ecosystem.interaction.At(j, i) * parasitized * share
+			}
+		}
+	}
+}
+
+// DiscreteLVMap is the discrete-time LV model x_i' = x_i (1 + r_i + Σ_j a_ij x_j), the LV equations stepped with
+// one generation as the time interval. Populations that the map would make negative die out.
+func DiscreteLVMap(ecosystem *Ecosystem, x, next []float64) {
+	for i := range x {
+		next[i] = math.Max(0, x[i]*(1+ecosystem.deathGrowth.At(i, 0)+interactionSum(ecosystem, x, i)))
+	}
+}
+
+// DiscreteState holds the populations of a discrete-generation model between generations, like LVState does for the
+// continuous LV equations.
+type DiscreteState struct {
+	ecosystem *Ecosystem // the ecosystem the state was initialized from, whose matrices are shared by the snapshots
+	step      DiscreteMap
+	pop       []float64 // populations, indexed by species index
+	next      []float64 // scratch space for the next generation
+}
+
+// InitializeDiscreteState() takes a pointer of Ecosystem object with a discrete-generation model, and returns its DiscreteState.
+func InitializeDiscreteState(ecosystem *Ecosystem) *DiscreteState {
+	step, ok := discreteModels[ecosystem.model]
+	if !ok {
+		panic("Error: unknown discrete-generation model " + ecosystem.model)
+	}
+	if ecosystem.model == "nicholson-bailey" && !hasConsumer(ecosystem.species) {
+		panic("Error: the Nicholson-Bailey model needs at least one species with the consumer role as parasitoid.")
+	}
+
+	n := len(ecosystem.species)
+	state := &DiscreteState{ecosystem: ecosystem, step: step, pop: make([]float64, n), next: make([]float64, n)}
+	for _, specie := range ecosystem.species {
+		state.pop[specie.index] = specie.population
+	}
+	return state
+}
+
+// StepDiscreteState() advances a DiscreteState by one generation of its model.
+func StepDiscreteState(state *DiscreteState) {
+	// switching predators choose their prey from the populations of the current generation
+	current := state.ecosystem
+	if current.switching != nil {
+		current = &Ecosystem{species: current.species, interaction: EffectiveInteraction(current, state.pop),
+			deathGrowth: current.deathGrowth, model: current.model, higherOrder: current.higherOrder}
+	}
+	state.step(current, state.pop, state.next)
+	copy(state.pop, state.next)
+}
+
+// EcosystemFromDiscreteState() takes a DiscreteState, and returns a new Ecosystem object with its current populations,
+// sharing the matrices of the state's ecosystem like EcosystemFromState().
+func EcosystemFromDiscreteState(state *DiscreteState) *Ecosystem {
+	newEcosystem := &Ecosystem{
+		species:     CopySpecies(state.ecosystem.species),
+		interaction: state.ecosystem.interaction,
+		deathGrowth: state.ecosystem.deathGrowth,
+		model:       state.ecosystem.model,
+		higherOrder: state.ecosystem.higherOrder,
+		switching:   state.ecosystem.switching,
+	}
+	for _, specie := range newEcosystem.species {
+		specie.population = state.pop[specie.index]
+	}
+	return newEcosystem
+}
+
+// SimulateDiscrete() takes the initial *Ecosystem object of a discrete-generation model, a number of generations
+// and a sampling interval. It iterates the model's map once per generation, and returns the time points
+// 0, sampleEvery, 2*sampleEvery, ... up to numGens, which share the matrices of the initial ecosystem.
+func SimulateDiscrete(initialEcosystem *Ecosystem, numGens, sampleEvery int) []*Ecosystem {
+	if sampleEvery <= 0 {
+		panic("Error: nonpositive number given as sampling interval.")
+	}
+
+	state := InitializeDiscreteState(initialEcosystem)
+	timePoints := make([]*Ecosystem, 0, numGens/sampleEvery+1)
+	timePoints = append(timePoints, initialEcosystem)
+	for generation := 1; generation <= numGens; generation++ {
+		StepDiscreteState(state)
+		if generation%sampleEvery == 0 {
+			timePoints = append(timePoints, EcosystemFromDiscreteState(state))
+		}
+	}
+
+	return timePoints
+}
+
+// RequireContinuous() takes a pointer of Ecosystem object and the name of a command, and panics if the ecosystem follows
+// a discrete-generation model: the command analyzes the continuous LV equations, whose equilibria, Jacobian and steps
+// do not describe a map.
+func RequireContinuous(ecosystem *Ecosystem, command string) {
+	if ecosystem.model != "" {
+		panic("Error: the " + command + " command analyzes the continuous LV equations and does not support the " +
+			ecosystem.model + " model.")
+	}
+}
+
+// hasConsumer() returns true if any of the species has the consumer role.
+func hasConsumer(species []*Specie) bool {
+	for _, specie := range species {
+		if specie.role == "consumer" {
+			return true
+		}
+	}
+	return false
+}
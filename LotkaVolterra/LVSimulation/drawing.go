@@ -1,17 +1,24 @@
 package main
 
 import (
-	"canvas"
 	"fmt"
 	"image"
+	"image/draw"
 	"math/rand"
 	"time"
 )
 
+// DrawEcoBoards() takes the time points of a run, the width of the canvas and the frequency of the frames,
+// and returns the frames of EcoBoardRenderer() in memory.
 func DrawEcoBoards(timePoints []*Ecosystem, canvasWidth int, frequency int) []image.Image {
-	// create a image list slice
-	imageList := make([]image.Image, 0)
+	numFrames, render := EcoBoardRenderer(timePoints, canvasWidth, frequency)
+	return RenderFrames(numFrames, render)
+}
 
+// EcoBoardRenderer() takes the time points of a run, the width of the canvas and the frequency of the frames.
+// It gives every species a position and a color, and returns the number of frames, one every frequency time points,
+// and the FrameRenderer drawing frame k as the circles of the species at time point k*frequency.
+func EcoBoardRenderer(timePoints []*Ecosystem, canvasWidth int, frequency int) (int, FrameRenderer) {
 	// count the number of species
 	numSpecies := len(timePoints[0].species)
 
@@ -22,22 +29,25 @@ func DrawEcoBoards(timePoints []*Ecosystem, canvasWidth int, frequency int) []im
 	// create a color slice
 	color := make([][]uint8, numSpecies)
 
-	// range over all species and assign them a position, store in slice
-	for i := 0; i < numSpecies; i++ {
+	// range over all species and assign them a position and a color, store in slice
+	// species with a color given by the user keep it, the others get a random one
+	for i, specie := range timePoints[0].species {
 		xPos[i] = GenPosition(canvasWidth)
 		yPos[i] = GenPosition(canvasWidth)
-		color[i] = GenRandColor()
+		if specie.color != nil {
+			color[i] = specie.color
+		} else {
+			color[i] = GenRandColor()
+		}
 	}
 
 	fmt.Println("The coloe slice is: ", color)
 
-	// range over all time points and draw them
-	for i := range timePoints {
-		if i%frequency == 0 {
-			imageList = append(imageList, DrawToCanvas(timePoints[i], canvasWidth, xPos, yPos, color))
-		}
+	// the frames only read the positions and colors, so they can be drawn concurrently
+	numFrames := (len(timePoints)-1)/frequency + 1
+	return numFrames, func(k int) image.Image {
+		return DrawToCanvas(timePoints[k*frequency], canvasWidth, xPos, yPos, color)
 	}
-	return imageList
 }
 
 // DrawToCanvas generates the image corresponding to a canvas after drawing a Universe
@@ -47,10 +57,10 @@ func DrawToCanvas(timePoint *Ecosystem, canvasWidth int, xPos, yPos []int, color
 	rScaler := 20.0
 
 	// set a new square canvas
-	c := canvas.CreateNewCanvas(canvasWidth, canvasWidth)
+	c := CreateNewCanvas(canvasWidth, canvasWidth)
 
 	// create a black background
-	c.SetFillColor(canvas.MakeColor(0, 0, 0))
+	c.SetFillColor(MakeColor(0, 0, 0))
 	c.ClearRect(0, 0, canvasWidth, canvasWidth)
 	c.Fill()
 
@@ -62,7 +72,7 @@ func DrawToCanvas(timePoint *Ecosystem, canvasWidth int, xPos, yPos []int, color
 		blue := color[s.index][2]
 
 		// set color, position and radius
-		c.SetFillColor(canvas.MakeColor(uint8(red), uint8(green), uint8(blue)))
+		c.SetFillColor(MakeColor(uint8(red), uint8(green), uint8(blue)))
 		centerX := float64(xPos[s.index])
 		centerY := float64(yPos[s.index])
 		r := s.population * rScaler
@@ -81,8 +91,35 @@ func DrawToCanvas(timePoint *Ecosystem, canvasWidth int, xPos, yPos []int, color
 		c.Fill()
 	}
 
+	// draw a legend with the name of each species in its color
+	img := c.GetImage()
+	DrawLegend(img, timePoint.species, color)
+
 	// we want to return an image!
-	return c.GetImage()
+	return img
+}
+
+// DrawLegend draws the name of each species next to a swatch of its color in the top left corner of an image.
+func DrawLegend(img draw.Image, species []*Specie, color [][]uint8) {
+	scale := 2
+	lineHeight := (glyphHeight + 3) * scale
+
+	// large communities only list the species that fit on the image, and count the rest
+	maxLines := (img.Bounds().Dy() - 10) / lineHeight
+	if len(species) > maxLines && maxLines > 0 {
+		more := fmt.Sprintf("+%d more", len(species)-maxLines+1)
+		DrawText(img, 5, 5+(maxLines-1)*lineHeight, more, MakeColor(255, 255, 255), scale)
+		species = species[:maxLines-1]
+	}
+
+	for i, s := range species {
+		y := 5 + i*lineHeight
+		swatch := MakeColor(color[s.index][0], color[s.index][1], color[s.index][2])
+
+		// draw a square swatch, then the name in white
+		draw.Draw(img, image.Rect(5, y, 5+glyphHeight*scale, y+glyphHeight*scale), image.NewUniform(swatch), image.Point{}, draw.Src)
+		DrawText(img, 5+(glyphHeight+3)*scale, y, SpeciesName(s), MakeColor(255, 255, 255), scale)
+	}
 }
 
 func GenPosition(canvasWidth int) int {
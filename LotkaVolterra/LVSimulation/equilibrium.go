@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// EquilibriumReport holds the interior equilibrium of an ecosystem and its local stability.
+type EquilibriumReport struct {
+	populations []float64
+	eigenvalues []complex128
+	exists      bool // false if the interaction matrix is singular
+	feasible    bool // true if every population at the equilibrium is positive
+	stable      bool // true if every eigenvalue of the Jacobian has a negative real part
+}
+
+// InteriorEquilibrium() takes a pointer of Ecosystem object, and returns the populations at which
+// every per-capita growth rate r_i + Σ_j a_ij x_j is zero, i.e. the solution of interaction * x = -deathGrowth.
+// The second return value is false if the interaction matrix is singular and no unique equilibrium exists.
+// It is also false for ecosystems with stage-structured species, whose stage flows make the equilibrium condition nonlinear.
+// With higher-order interactions or prey switching the condition is nonlinear, and the equilibrium is found by NonlinearEquilibrium().
+func InteriorEquilibrium(ecosystem *Ecosystem) ([]float64, bool) {
+	if ecosystem.stageTransfer != nil {
+		return nil, false
+	}
+	if ecosystem.higherOrder != nil || ecosystem.switching != nil {
+		return NonlinearEquilibrium(ecosystem)
+	}
+
+	n := len(ecosystem.species)
+
+	// the right hand side is the negative growth vector
+	rhs := mat.NewVecDense(n, nil)
+	for i := 0; i < n; i++ {
+		rhs.SetVec(i, -ecosystem.deathGrowth.At(i, 0))
+	}
+
+	// SolveVec also reports a matrix that is singular to working precision as an error
+	var x mat.VecDense
+	if err := x.SolveVec(ecosystem.interaction, rhs); err != nil {
+		return nil, false
+	}
+
+	return x.RawVector().Data, true
+}
+
+// Jacobian() takes a pointer of Ecosystem object and a slice of populations,
+// and returns the Jacobian matrix of the LV equations dx_i/dt = x_i (r_i + Σ_j a_ij x_j) at those populations:
+// J_ij = δ_ij (r_i + Σ_k a_ik x_k) + x_i a_ij, plus the stage transfer matrix for stage-structured species
+// and the derivatives of the higher-order terms. With prey switching, a_ij is the switched interaction of EffectiveInteraction()
+// and the derivatives of the switched attack rates are added.
+func Jacobian(ecosystem *Ecosystem, x []float64) *mat.Dense {
+	n := len(x)
+	jacobian := mat.NewDense(n, n, nil)
+	interaction := EffectiveInteraction(ecosystem, x)
+
+	for i := 0; i < n; i++ {
+		// per-capita growth rate of species i
+		growth := ecosystem.deathGrowth.At(i, 0)
+		for k := 0; k < n; k++ {
+			growth += interaction.At(i, k) * x[k]
+		}
+
+		for j := 0; j < n; j++ {
+			value := x[i] * interaction.At(i, j)
+			if i == j {
+				value += growth
+			}
+			if ecosystem.stageTransfer != nil {
+				value += ecosystem.stageTransfer.At(i, j)
+			}
+			jacobian.Set(i, j, value)
+		}
+	}
+
+	// x_i Σ_jk b_ijk x_j x_k adds its value divided by x_i on the diagonal and x_i times its gradient
+	if ecosystem.higherOrder != nil {
+		AddHigherOrderGradient(ecosystem.higherOrder, x, x, jacobian)
+		for i := 0; i < n; i++ {
+			jacobian.Set(i, i, jacobian.At(i, i)+HigherOrderTerm(ecosystem.higherOrder, i, x))
+		}
+	}
+	if ecosystem.switching != nil {
+		AddSwitchingGradient(ecosystem.switching, ecosystem.interaction, x, x, jacobian)
+	}
+
+	return jacobian
+}
+
+// Eigenvalues() takes a square matrix, and returns its eigenvalues.
+func Eigenvalues(m mat.Matrix) []complex128 {
+	var eigen mat.Eigen
+	if ok := eigen.Factorize(m, mat.EigenNone); !ok {
+		panic("Error: eigenvalue decomposition failed.")
+	}
+	return eigen.Values(nil)
+}
+
+// MaxRealPart() returns the largest real part of a slice of eigenvalues.
+func MaxRealPart(eigenvalues []complex128) float64 {
+	max := math.Inf(-1)
+	for _, value := range eigenvalues {
+		max = math.Max(max, real(value))
+	}
+	return max
+}
+
+// AnalyzeEquilibrium() takes a pointer of Ecosystem object, finds its interior equilibrium,
+// and returns an EquilibriumReport with its feasibility and the eigenvalues of the Jacobian there.
+func AnalyzeEquilibrium(ecosystem *Ecosystem) EquilibriumReport {
+	report := EquilibriumReport{}
+
+	report.populations, report.exists = InteriorEquilibrium(ecosystem)
+	if !report.exists {
+		return report
+	}
+
+	report.feasible = true
+	for _, x := range report.populations {
+		if x <= 0 {
+			report.feasible = false
+		}
+	}
+
+	report.eigenvalues = Eigenvalues(Jacobian(ecosystem, report.populations))
+	report.stable = MaxRealPart(report.eigenvalues) < 0
+
+	return report
+}
+
+// PrintEquilibriumReport prints an EquilibriumReport on stdout, naming the species of the ecosystem.
+func PrintEquilibriumReport(report EquilibriumReport, species []*Specie) {
+	if !report.exists {
+		fmt.Println("No unique interior equilibrium: the interaction matrix is singular, the ecosystem has stages, or no root of the higher-order growth rates was found.")
+		return
+	}
+
+	fmt.Print("Interior equilibrium:")
+	for i, x := range report.populations {
+		fmt.Printf(" %s=%.4g", SpeciesName(species[i]), x)
+	}
+	fmt.Println()
+	fmt.Println("Feasible (all populations positive):", report.feasible)
+
+	fmt.Print("Jacobian eigenvalues:")
+	for _, value := range report.eigenvalues {
+		if imag(value) == 0 {
+			fmt.Printf(" %.4g", real(value))
+		} else {
+			fmt.Printf(" %.4g%+.4gi", real(value), imag(value))
+		}
+	}
+	fmt.Println()
+
+	fmt.Println("Locally stable:", report.stable)
+	if report.stable && report.feasible {
+		// oscillatory return if the leading eigenvalue is complex
+		leading := report.eigenvalues[0]
+		for _, value := range report.eigenvalues {
+			if real(value) > real(leading) {
+				leading = value
+			}
+		}
+		if imag(leading) != 0 {
+			fmt.Printf("Damped oscillations with period %.4g\n", 2*math.Pi/math.Abs(imag(leading)))
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TraitModel holds the parameters of the competition model in which a continuous trait z determines the interactions:
+// the carrying capacity K(z) = capacity · exp(-z² / (2 capacityWidth²)) is largest at z = 0,
+// and species compete with α(z_i, z_j) = exp(-|z_i - z_j|^shape / (2 competitionWidth^shape)), more strongly the more similar they are.
+// Evolutionary branching is expected when competitionWidth < capacityWidth with the Gaussian kernel (shape 2);
+// flatter kernels (shape > 2) make the trait at z = 0 evolutionarily stable instead.
+type TraitModel struct {
+	growth           float64
+	capacity         float64
+	capacityWidth    float64
+	competitionWidth float64
+	kernelShape      float64
+}
+
+// Lineage is one species of an eco-evolutionary run, with the species it arose from by mutation.
+type Lineage struct {
+	id         int
+	parent     int // id of the parent lineage, or -1 for the ancestor
+	trait      float64
+	birth      float64
+	extinction float64 // time the lineage went extinct, or -1 while it is alive
+	population float64
+}
+
+// TraitSnapshot is the trait and population of a living lineage at one time.
+type TraitSnapshot struct {
+	time       float64
+	lineage    int
+	trait      float64
+	population float64
+}
+
+// BranchingEvent is a time at which the living lineages split into more trait clusters than before.
+type BranchingEvent struct {
+	time     float64
+	clusters []float64 // population-weighted mean trait of every cluster after the branching
+}
+
+// EvolutionSettings holds the parameters of an eco-evolutionary run.
+type EvolutionSettings struct {
+	model           TraitModel
+	mutationRate    float64 // expected mutants per unit of population per unit of time
+	mutationSD      float64 // standard deviation of the trait change of a mutant
+	invasionDensity float64 // initial population of every mutant
+	threshold       float64 // population below which a lineage goes extinct
+	resolution      float64 // trait difference below which two lineages are merged into the more abundant one
+	clusterGap      float64 // trait gap separating two clusters
+	numIntervals    int     // number of ecological intervals, with at most one mutant each
+	interval        int     // generations simulated in every interval
+	time            float64
+}
+
+// EvolutionRun holds the outcome of an eco-evolutionary run.
+type EvolutionRun struct {
+	lineages   []Lineage
+	snapshots  []TraitSnapshot
+	branchings []BranchingEvent
+}
+
+// CarryingCapacity() returns the carrying capacity of a trait in a TraitModel.
+func CarryingCapacity(model TraitModel, trait float64) float64 {
+	return model.capacity * math.Exp(-trait*trait/(2*model.capacityWidth*model.capacityWidth))
+}
+
+// CompetitionKernel() returns the competition between two traits in a TraitModel.
+func CompetitionKernel(model TraitModel, trait, other float64) float64 {
+	d := math.Abs(trait-other) / model.competitionWidth
+	return math.Exp(-math.Pow(d, model.kernelShape) / 2)
+}
+
+// TraitEcosystem() takes a TraitModel and the living lineages, and returns the competitive Ecosystem of these lineages,
+// built with CompetitionToLV() from the carrying capacities and competition kernel of their traits.
+func TraitEcosystem(model TraitModel, living []*Lineage) *Ecosystem {
+	n := len(living)
+	params := CompetitionParameters{
+		growth:   make([]float64, n),
+		capacity: make([]float64, n),
+		alpha:    mat.NewDense(n, n, nil),
+	}
+	pop := make([]float64, n)
+	metadata := make([]SpeciesMetadata, n)
+
+	for i, lineage := range living {
+		params.growth[i] = model.growth
+		params.capacity[i] = CarryingCapacity(model, lineage.trait)
+		for j, other := range living {
+			params.alpha.(*mat.Dense).Set(i, j, CompetitionKernel(model, lineage.trait, other.trait))
+		}
+		pop[i] = lineage.population
+		metadata[i].name = "Lineage " + strconv.Itoa(lineage.id)
+	}
+
+	ecosystem := InitializeCompetitiveEcosystem(n, pop, metadata, params)
+	for i, specie := range ecosystem.species {
+		specie.trait = living[i].trait
+	}
+
+	return ecosystem
+}
+
+// TraitClusters() takes the living lineages and a trait gap, and returns the population-weighted mean trait of every cluster,
+// in increasing order. Lineages with less than 1% of the total population (such as new mutants) are left out,
+// and two lineages belong to different clusters if their traits are further apart than the gap with no lineage between them.
+func TraitClusters(living []*Lineage, gap float64) []float64 {
+	total := 0.0
+	for _, lineage := range living {
+		total += lineage.population
+	}
+
+	common := make([]*Lineage, 0, len(living))
+	for _, lineage := range living {
+		if lineage.population >= 0.01*total {
+			common = append(common, lineage)
+		}
+	}
+	sort.Slice(common, func(a, b int) bool { return common[a].trait < common[b].trait })
+
+	clusters := make([]float64, 0)
+	weighted, weight := 0.0, 0.0
+	for k, lineage := range common {
+		if k > 0 && lineage.trait-common[k-1].trait > gap {
+			clusters = append(clusters, weighted/weight)
+			weighted, weight = 0, 0
+		}
+		weighted += lineage.trait * lineage.population
+		weight += lineage.population
+	}
+	if weight > 0 {
+		clusters = append(clusters, weighted/weight)
+	}
+
+	return clusters
+}
+
+// MergeLineages() takes the lineages of a run, the ids of the living ones, a trait resolution and the current time.
+// Every living lineage whose trait is within the resolution of a more abundant living lineage is merged into it:
+// its population is added to that lineage and it is marked extinct. Without this, nearly neutral mutants pile up
+// around every resident and slow down the simulation. It returns the ids of the remaining lineages, in their original order.
+func MergeLineages(lineages []Lineage, living []int, resolution, now float64) []int {
+	byPopulation := make([]int, len(living))
+	copy(byPopulation, living)
+	sort.SliceStable(byPopulation, func(a, b int) bool {
+		return lineages[byPopulation[a]].population > lineages[byPopulation[b]].population
+	})
+
+	kept := make([]int, 0, len(living))
+	merged := make(map[int]bool)
+	for _, id := range byPopulation {
+		for _, other := range kept {
+			if math.Abs(lineages[id].trait-lineages[other].trait) < resolution {
+				lineages[other].population += lineages[id].population
+				lineages[id].extinction = now
+				merged[id] = true
+				break
+			}
+		}
+		if !merged[id] {
+			kept = append(kept, id)
+		}
+	}
+
+	remaining := make([]int, 0, len(kept))
+	for _, id := range living {
+		if !merged[id] {
+			remaining = append(remaining, id)
+		}
+	}
+	return remaining
+}
+
+// Evolve() takes the trait of the ancestor, evolution settings, a snapshot interval and a random number generator.
+// Starting from the ancestor at its carrying capacity, every interval a mutant of a parent chosen in proportion
+// to its population may arise with a trait drawn around its parent's, at low density. The lineages are then simulated
+// for the interval, and those below the threshold go extinct. It returns the lineages, a snapshot of the living lineages
+// every snapshotEvery intervals, and the branching events.
+func Evolve(ancestorTrait float64, settings EvolutionSettings, snapshotEvery int, rng *rand.Rand) EvolutionRun {
+	run := EvolutionRun{lineages: []Lineage{{
+		id:         0,
+		parent:     -1,
+		trait:      ancestorTrait,
+		extinction: -1,
+		population: CarryingCapacity(settings.model, ancestorTrait),
+	}}}
+	living := []int{0}
+	intervalTime := float64(settings.interval) * settings.time
+	numClusters := 1
+
+	for step := 0; step < settings.numIntervals; step++ {
+		now := float64(step) * intervalTime
+
+		// at most one mutant per interval, with probability 1 - exp(-expected number of mutants)
+		total := 0.0
+		for _, id := range living {
+			total += run.lineages[id].population
+		}
+		if rng.Float64() < 1-math.Exp(-settings.mutationRate*total*intervalTime) {
+			choice := rng.Float64() * total
+			parent := living[len(living)-1]
+			for _, id := range living {
+				choice -= run.lineages[id].population
+				if choice < 0 {
+					parent = id
+					break
+				}
+			}
+
+			mutant := Lineage{
+				id:         len(run.lineages),
+				parent:     parent,
+				trait:      run.lineages[parent].trait + rng.NormFloat64()*settings.mutationSD,
+				birth:      now,
+				extinction: -1,
+				population: settings.invasionDensity,
+			}
+			run.lineages = append(run.lineages, mutant)
+			living = append(living, mutant.id)
+		}
+
+		// simulate the interval
+		current := make([]*Lineage, len(living))
+		for k, id := range living {
+			current[k] = &run.lineages[id]
+		}
+		timePoints := SimulateEcosystemSampled(TraitEcosystem(settings.model, current), settings.interval, settings.time, settings.interval)
+		final := timePoints[len(timePoints)-1]
+
+		// prune the extinct lineages
+		survivors := make([]int, 0, len(living))
+		for k, id := range living {
+			run.lineages[id].population = final.species[k].population
+			if final.species[k].population < settings.threshold {
+				run.lineages[id].extinction = now + intervalTime
+			} else {
+				survivors = append(survivors, id)
+			}
+		}
+		living = MergeLineages(run.lineages, survivors, settings.resolution, now+intervalTime)
+		if len(living) == 0 {
+			fmt.Println("Every lineage went extinct at time", now+intervalTime)
+			break
+		}
+
+		current = current[:0]
+		for _, id := range living {
+			current = append(current, &run.lineages[id])
+		}
+
+		if step%snapshotEvery == 0 {
+			for _, lineage := range current {
+				run.snapshots = append(run.snapshots, TraitSnapshot{time: now + intervalTime, lineage: lineage.id, trait: lineage.trait, population: lineage.population})
+			}
+		}
+
+		clusters := TraitClusters(current, settings.clusterGap)
+		if len(clusters) > numClusters {
+			run.branchings = append(run.branchings, BranchingEvent{time: now + intervalTime, clusters: clusters})
+		}
+		numClusters = len(clusters)
+	}
+
+	return run
+}
+
+// WriteLineagesCSV() writes the lineages of an eco-evolutionary run to a CSV file, one row per lineage with its parent,
+// so that the phylogeny-like tree of the run can be rebuilt.
+func WriteLineagesCSV(lineages []Lineage, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Lineage", "Parent", "Trait", "Birth", "Extinction", "Population"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for _, lineage := range lineages {
+		extinction := ""
+		if lineage.extinction >= 0 {
+			extinction = strconv.FormatFloat(lineage.extinction, 'f', -1, 64)
+		}
+		row := []string{
+			strconv.Itoa(lineage.id),
+			strconv.Itoa(lineage.parent),
+			strconv.FormatFloat(lineage.trait, 'f', -1, 64),
+			strconv.FormatFloat(lineage.birth, 'f', -1, 64),
+			extinction,
+			strconv.FormatFloat(lineage.population, 'f', -1, 64),
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// WriteTraitsCSV() writes the snapshots of an eco-evolutionary run to a CSV file, one row per living lineage and time.
+func WriteTraitsCSV(snapshots []TraitSnapshot, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Time", "Lineage", "Trait", "Population"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		row := []string{
+			strconv.FormatFloat(snapshot.time, 'f', -1, 64),
+			strconv.Itoa(snapshot.lineage),
+			strconv.FormatFloat(snapshot.trait, 'f', -1, 64),
+			strconv.FormatFloat(snapshot.population, 'f', -1, 64),
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// DrawTraits() takes the snapshots of an eco-evolutionary run and its duration, and returns a Plot of the trait
+// of every living lineage against time, in which branching shows as the trait distribution splitting.
+func DrawTraits(snapshots []TraitSnapshot, duration float64) *Plot {
+	traits := make([]float64, len(snapshots))
+	for k, snapshot := range snapshots {
+		traits[k] = snapshot.trait
+	}
+	yMin, yMax := paddedRange(traits)
+
+	plot := NewPlot(600, 400, 0, duration, yMin, yMax, 0)
+	for _, snapshot := range snapshots {
+		PlotPoint(plot, snapshot.time, snapshot.trait, 2, CategoryColor(0))
+	}
+	DrawAxes(plot, "Trait evolution", "Time", "Trait")
+
+	return plot
+}
+
+// EvolveCommand runs the eco-evolutionary mode: species compete through their traits and mutants arise over time.
+// The lineages, the trait snapshots and the branching events are written to ./output/<name>_lineages.csv,
+// ./output/<name>_traits.csv and ./output/<name>_branching.csv, with the traits plotted in ./output/<name>_traits.png.
+func EvolveCommand(args []string) {
+	flags := flag.NewFlagSet("evolve", flag.ExitOnError)
+	ancestor := flags.Float64("trait", -1, "trait of the ancestor")
+	growth := flags.Float64("growth", 1, "intrinsic growth rate")
+	capacity := flags.Float64("capacity", 1, "largest carrying capacity, at trait 0")
+	capacityWidth := flags.Float64("sigmak", 1, "width of the carrying capacity over the trait")
+	competitionWidth := flags.Float64("sigmaa", 0.5, "width of the competition kernel")
+	kernelShape := flags.Float64("shape", 2, "exponent of the competition kernel: 2 is Gaussian, larger is flatter")
+	mutationRate := flags.Float64("rate", 0.02, "expected mutants per unit of population per unit of time")
+	mutationSD := flags.Float64("sd", 0.05, "standard deviation of the trait change of a mutant")
+	density := flags.Float64("density", 0.001, "initial population of every mutant")
+	threshold := flags.Float64("threshold", 1e-4, "population below which a lineage goes extinct")
+	gap := flags.Float64("gap", 0.2, "trait gap separating two clusters")
+	resolution := flags.Float64("resolution", 0.02, "trait difference below which two lineages are merged")
+	duration := flags.Float64("duration", 20000, "length of the run, in time units")
+	interval := flags.Int("interval", 500, "generations simulated between mutations")
+	dt := flags.Float64("time", 0.01, "time interval of every generation")
+	snapshotEvery := flags.Int("snapshot", 4, "number of intervals between trait snapshots")
+	seed := flags.Int64("seed", 0, "random seed (default from the clock)")
+	name := flags.String("name", "evolution", "name of the output files")
+	flags.Parse(args)
+
+	if *interval <= 0 || *dt <= 0 || *duration <= 0 || *snapshotEvery <= 0 {
+		panic("Error: nonpositive number given as duration or interval.")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	fmt.Println("Random seed:", *seed)
+
+	settings := EvolutionSettings{
+		model:           TraitModel{growth: *growth, capacity: *capacity, capacityWidth: *capacityWidth, competitionWidth: *competitionWidth, kernelShape: *kernelShape},
+		mutationRate:    *mutationRate,
+		mutationSD:      *mutationSD,
+		invasionDensity: *density,
+		threshold:       *threshold,
+		resolution:      *resolution,
+		clusterGap:      *gap,
+		numIntervals:    int(*duration / (float64(*interval) * *dt)),
+		interval:        *interval,
+		time:            *dt,
+	}
+
+	fmt.Println("Evolving for", *duration, "time units...")
+	run := Evolve(*ancestor, settings, *snapshotEvery, rng)
+
+	alive := 0
+	for _, lineage := range run.lineages {
+		if lineage.extinction < 0 {
+			alive++
+		}
+	}
+	fmt.Printf("%d lineages arose, %d alive at the end\n", len(run.lineages), alive)
+	for _, event := range run.branchings {
+		traits := make([]string, len(event.clusters))
+		for k, trait := range event.clusters {
+			traits[k] = strconv.FormatFloat(trait, 'f', 3, 64)
+		}
+		fmt.Printf("Branching at time %.1f into %d clusters at traits %s\n", event.time, len(event.clusters), strings.Join(traits, ", "))
+	}
+
+	filename := "./output/" + *name
+	WriteLineagesCSV(run.lineages, filename+"_lineages.csv")
+	WriteTraitsCSV(run.snapshots, filename+"_traits.csv")
+	WriteBranchingCSV(run.branchings, filename+"_branching.csv")
+	SavePNG(DrawTraits(run.snapshots, *duration).img, filename+"_traits.png")
+	fmt.Println("Lineages, traits and branching events written to " + filename + "_lineages.csv, _traits.csv, _branching.csv and _traits.png")
+}
+
+// WriteBranchingCSV() writes the branching events of an eco-evolutionary run to a CSV file,
+// with the number of clusters after every event and their mean traits separated by spaces.
+func WriteBranchingCSV(events []BranchingEvent, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Time", "Clusters", "Traits"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for _, event := range events {
+		traits := make([]string, len(event.clusters))
+		for k, trait := range event.clusters {
+			traits[k] = strconv.FormatFloat(trait, 'f', -1, 64)
+		}
+		row := []string{strconv.FormatFloat(event.time, 'f', -1, 64), strconv.Itoa(len(event.clusters)), strings.Join(traits, " ")}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
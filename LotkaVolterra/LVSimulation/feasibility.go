@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// FeasibilitySettings holds the parameters of the sampling of growth-rate vectors.
+type FeasibilitySettings struct {
+	samples int   // number of growth-rate vectors sampled on the unit sphere
+	workers int   // number of workers sampling in parallel, each with its own random source
+	seed    int64 // worker w draws from rand.NewSource(seed + w), so a run is reproducible for a given seed and number of workers
+}
+
+// FeasibilityDomain holds the estimated size of the feasibility domain of an interaction matrix: the set of growth-rate
+// vectors r for which the interior equilibrium x* = -A⁻¹ r has every population positive.
+type FeasibilityDomain struct {
+	feasible   float64 // fraction of the sampled directions of r with a feasible equilibrium (Ω)
+	stable     float64 // fraction with a feasible and locally stable equilibrium
+	normalized float64 // Ω^(1/n), comparable between communities of different sizes
+	stdError   float64 // binomial standard error of the feasible fraction
+	samples    int
+}
+
+// BoundaryDistance holds the position of a growth-rate vector relative to the boundary of the feasibility domain.
+type BoundaryDistance struct {
+	angle   float64 // angle in radians to the nearest facet of the domain: positive inside, negative outside
+	nearest int     // species whose equilibrium population reaches 0 on the nearest facet
+}
+
+// SampleFeasibility() takes an interaction matrix and feasibility settings. It samples directions of the growth-rate
+// vector uniformly on the unit sphere (normalized Gaussian vectors), solves x* = -A⁻¹ r for each, and returns the fractions
+// of directions with a feasible and with a feasible and stable equilibrium. The second return value is false if A is singular.
+func SampleFeasibility(interaction mat.Matrix, settings FeasibilitySettings) (FeasibilityDomain, bool) {
+	n, _ := interaction.Dims()
+	var inverse mat.Dense
+	if err := inverse.Inverse(interaction); err != nil {
+		return FeasibilityDomain{}, false
+	}
+
+	feasibleCounts := make([]int, settings.workers)
+	stableCounts := make([]int, settings.workers)
+	var wg sync.WaitGroup
+	for w := 0; w < settings.workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(settings.seed + int64(w)))
+			growth := mat.NewVecDense(n, nil)
+			var x mat.VecDense
+			jacobian := mat.NewDense(n, n, nil)
+
+			// every worker counts into its own element, so no lock is needed
+			for k := w; k < settings.samples; k += settings.workers {
+				for i := 0; i < n; i++ {
+					growth.SetVec(i, rng.NormFloat64())
+				}
+				growth.ScaleVec(1/mat.Norm(growth, 2), growth)
+
+				x.MulVec(&inverse, growth)
+				x.ScaleVec(-1, &x)
+				if floats.Min(x.RawVector().Data) <= 0 {
+					continue
+				}
+				feasibleCounts[w]++
+
+				// every per-capita growth rate is zero at the equilibrium, so the Jacobian is diag(x*) A
+				for i := 0; i < n; i++ {
+					for j := 0; j < n; j++ {
+						jacobian.Set(i, j, x.AtVec(i)*interaction.At(i, j))
+					}
+				}
+				if MaxRealPart(Eigenvalues(jacobian)) < 0 {
+					stableCounts[w]++
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	feasible, stable := 0, 0
+	for w := range feasibleCounts {
+		feasible += feasibleCounts[w]
+		stable += stableCounts[w]
+	}
+
+	domain := FeasibilityDomain{samples: settings.samples}
+	domain.feasible = float64(feasible) / float64(settings.samples)
+	domain.stable = float64(stable) / float64(settings.samples)
+	domain.normalized = math.Pow(domain.feasible, 1/float64(n))
+	domain.stdError = math.Sqrt(domain.feasible * (1 - domain.feasible) / float64(settings.samples))
+
+	return domain, true
+}
+
+// DistanceToBoundary() takes an interaction matrix and a growth-rate vector, and returns the angle between the vector and
+// the nearest facet of the feasibility domain. The domain is the cone of vectors r with -A⁻¹ r > 0, bounded by the hyperplanes
+// on which one equilibrium population (-A⁻¹ r)_k is 0, so the angle to facet k is arcsin of (-A⁻¹ r)_k / (|row k of A⁻¹| |r|).
+// Inside the domain the smallest angle is the distance to its boundary; outside it is negative, the angle past the most
+// violated facet. The second return value is false if A is singular or r is zero.
+func DistanceToBoundary(interaction mat.Matrix, growth []float64) (BoundaryDistance, bool) {
+	n, _ := interaction.Dims()
+	var inverse mat.Dense
+	if err := inverse.Inverse(interaction); err != nil {
+		return BoundaryDistance{}, false
+	}
+	norm := floats.Norm(growth, 2)
+	if norm == 0 {
+		return BoundaryDistance{}, false
+	}
+
+	distance := BoundaryDistance{angle: math.Inf(1), nearest: -1}
+	for k := 0; k < n; k++ {
+		row := inverse.RawRowView(k)
+		sine := -floats.Dot(row, growth) / (floats.Norm(row, 2) * norm)
+		if angle := math.Asin(math.Max(-1, math.Min(1, sine))); angle < distance.angle {
+			distance.angle, distance.nearest = angle, k
+		}
+	}
+
+	return distance, true
+}
+
+// FeasibilityCommand estimates the structural stability of the interaction matrix of scenario files or presets (every preset
+// by default): the fraction of growth-rate directions, sampled uniformly on the unit sphere, that give a feasible and a feasible
+// and stable interior equilibrium, and the angle between the scenario's own growth rates and the boundary of the feasibility domain.
+// The results are printed and written to ./output/feasibility.csv.
+func FeasibilityCommand(args []string) {
+	flags := flag.NewFlagSet("feasibility", flag.ExitOnError)
+	samples := flags.Int("samples", 100000, "number of growth-rate vectors sampled on the unit sphere")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of workers sampling in parallel")
+	seed := flags.Int64("seed", 0, "random seed (default from the clock)")
+	flags.Parse(args)
+
+	if *samples <= 0 {
+		panic("Error: nonpositive number given as number of samples.")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Println("Random seed:", *seed)
+	settings := FeasibilitySettings{samples: *samples, workers: max(1, *workers), seed: *seed}
+
+	names := flags.Args()
+	if len(names) == 0 {
+		names = PresetNames()
+	}
+
+	file, err := os.Create("./output/feasibility.csv")
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+	csvWriter := csv.NewWriter(file)
+	defer csvWriter.Flush()
+	header := []string{"Scenario", "Species", "Feasible fraction", "Standard error", "Normalized feasible fraction",
+		"Feasible and stable fraction", "Angle to boundary (degrees)", "Nearest boundary species"}
+	if err := csvWriter.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Scenario\tSpecies\tFeasible Ω\tΩ^(1/n)\tFeasible and stable\tAngle to boundary\tNearest boundary")
+	for _, name := range names {
+		scenario := LoadScenario(name)
+		ecosystem := BuildEcosystem(scenario)
+		RequireContinuous(ecosystem, "feasibility")
+		if ecosystem.stageTransfer != nil || ecosystem.higherOrder != nil || ecosystem.switching != nil {
+			panic("Error: the feasibility domain is that of the pairwise interaction matrix, so the feasibility command " +
+				"does not support stage-structured species, higher-order interactions or prey switching.")
+		}
+		scenarioName := ScenarioSettings(scenario).name
+		n := len(ecosystem.species)
+
+		domain, ok := SampleFeasibility(ecosystem.interaction, settings)
+		growth := mat.Col(nil, 0, ecosystem.deathGrowth)
+		distance, hasDistance := DistanceToBoundary(ecosystem.interaction, growth)
+		if !ok || !hasDistance {
+			fmt.Fprintf(table, "%s\t%d\tsingular matrix\t-\t-\t-\t-\n", scenarioName, n)
+			if err := csvWriter.Write([]string{scenarioName, strconv.Itoa(n), "", "", "", "", "", ""}); err != nil {
+				fmt.Println("Error writing row:", err)
+			}
+			continue
+		}
+
+		degrees := distance.angle * 180 / math.Pi
+		fmt.Fprintf(table, "%s\t%d\t%.4f ± %.4f\t%.4f\t%.4f\t%+.2f°\t%s\n", scenarioName, n, domain.feasible, domain.stdError,
+			domain.normalized, domain.stable, degrees, SpeciesName(ecosystem.species[distance.nearest]))
+		row := []string{scenarioName, strconv.Itoa(n), strconv.FormatFloat(domain.feasible, 'f', -1, 64),
+			strconv.FormatFloat(domain.stdError, 'f', -1, 64), strconv.FormatFloat(domain.normalized, 'f', -1, 64),
+			strconv.FormatFloat(domain.stable, 'f', -1, 64), strconv.FormatFloat(degrees, 'f', -1, 64),
+			SpeciesName(ecosystem.species[distance.nearest])}
+		if err := csvWriter.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+		}
+	}
+	table.Flush()
+
+	fmt.Println("A negative angle means the growth rates lie outside the feasibility domain.")
+	fmt.Println("Results written to ./output/feasibility.csv")
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// maxFoodChains is the number of food chains after which EnumerateFoodChains() stops, as large webs have too many to list.
+const maxFoodChains = 1000000
+
+// FoodWeb holds who eats whom in an Ecosystem, inferred from the sign pattern of its interaction matrix.
+type FoodWeb struct {
+	names       []string
+	interaction mat.Matrix // a_ij: the effect of species j on species i
+	eats        [][]bool   // eats[c][r] is true if species c consumes species r
+}
+
+// FoodWebMetrics holds the structure of a FoodWeb.
+type FoodWebMetrics struct {
+	species         int
+	links           int // trophic links
+	connectance     float64
+	trophicLevels   []float64
+	omnivory        []float64 // omnivory index of every species: the variance of the trophic levels of its prey
+	omnivoreShare   float64   // fraction of the consumers feeding on more than one trophic level
+	numChains       int
+	meanChain       float64 // mean number of links of the chains from a basal species to a top predator
+	maxChain        int
+	modules         []int // module of every species
+	modularity      float64
+	nestedness      float64 // NODF of the consumer-resource matrix, between 0 and 100
+	chainsTruncated bool
+}
+
+// InferFoodWeb() takes an Ecosystem, and returns its FoodWeb: species c eats species r if r has a positive effect on c
+// and c a negative effect on r (a_cr > 0 and a_rc < 0). Pairs with any other sign pattern, such as competition
+// or mutualism, are not trophic links.
+func InferFoodWeb(ecosystem *Ecosystem) FoodWeb {
+	n := len(ecosystem.species)
+	web := FoodWeb{
+		names:       make([]string, n),
+		interaction: ecosystem.interaction,
+		eats:        make([][]bool, n),
+	}
+
+	for _, specie := range ecosystem.species {
+		web.names[specie.index] = SpeciesName(specie)
+	}
+	for c := 0; c < n; c++ {
+		web.eats[c] = make([]bool, n)
+		for r := 0; r < n; r++ {
+			web.eats[c][r] = c != r && ecosystem.interaction.At(c, r) > 0 && ecosystem.interaction.At(r, c) < 0
+		}
+	}
+
+	return web
+}
+
+// InteractionType() takes a FoodWeb and two species, and returns the kind of their interaction from its sign pattern:
+// "trophic", "competition", "mutualism", "amensalism", "commensalism" or "" if they do not interact.
+func InteractionType(web FoodWeb, i, j int) string {
+	if web.eats[i][j] || web.eats[j][i] {
+		return "trophic"
+	}
+
+	a, b := sign(web.interaction.At(i, j)), sign(web.interaction.At(j, i))
+	switch {
+	case a < 0 && b < 0:
+		return "competition"
+	case a > 0 && b > 0:
+		return "mutualism"
+	case a*b == 0 && a+b < 0:
+		return "amensalism"
+	case a*b == 0 && a+b > 0:
+		return "commensalism"
+	}
+	return ""
+}
+
+// sign() returns -1, 0 or 1 with the sign of a number.
+func sign(x float64) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// TrophicLevels() takes a FoodWeb, and returns the trophic level of every species: 1 for basal species and
+// 1 plus the mean level of its prey for consumers, weighted by the effect of every prey on the consumer.
+// The levels solve (I - P) TL = 1, where P holds the diet fractions; a web whose consumers only eat each other
+// in a loop has no solution, and NaN levels are returned.
+func TrophicLevels(web FoodWeb) []float64 {
+	n := len(web.names)
+	system := mat.NewDense(n, n, nil)
+	ones := mat.NewVecDense(n, nil)
+
+	for c := 0; c < n; c++ {
+		ones.SetVec(c, 1)
+		system.Set(c, c, 1)
+
+		diet := 0.0
+		for r := 0; r < n; r++ {
+			if web.eats[c][r] {
+				diet += web.interaction.At(c, r)
+			}
+		}
+		for r := 0; r < n; r++ {
+			if web.eats[c][r] {
+				system.Set(c, r, system.At(c, r)-web.interaction.At(c, r)/diet)
+			}
+		}
+	}
+
+	var levels mat.VecDense
+	if err := levels.SolveVec(system, ones); err != nil {
+		levels := make([]float64, n)
+		for i := range levels {
+			levels[i] = math.NaN()
+		}
+		return levels
+	}
+
+	return levels.RawVector().Data
+}
+
+// OmnivoryIndex() takes a FoodWeb and its trophic levels, and returns the omnivory index of every species:
+// the variance of the trophic levels of its prey weighted by its diet, 0 for basal species and specialists.
+func OmnivoryIndex(web FoodWeb, levels []float64) []float64 {
+	n := len(web.names)
+	omnivory := make([]float64, n)
+
+	for c := 0; c < n; c++ {
+		diet := 0.0
+		for r := 0; r < n; r++ {
+			if web.eats[c][r] {
+				diet += web.interaction.At(c, r)
+			}
+		}
+		for r := 0; r < n; r++ {
+			if web.eats[c][r] {
+				d := levels[r] - (levels[c] - 1)
+				omnivory[c] += web.interaction.At(c, r) / diet * d * d
+			}
+		}
+	}
+
+	return omnivory
+}
+
+// EnumerateFoodChains() takes a FoodWeb, and returns the number of links of every food chain: every path following
+// the trophic links from a basal species (one without prey) to a top predator (one without consumers) that visits
+// no species twice. It stops after maxFoodChains chains, and then also returns true.
+func EnumerateFoodChains(web FoodWeb) ([]int, bool) {
+	n := len(web.names)
+	consumers := make([][]int, n)
+	basal := make([]bool, n)
+	for r := 0; r < n; r++ {
+		basal[r] = true
+	}
+	for c := 0; c < n; c++ {
+		for r := 0; r < n; r++ {
+			if web.eats[c][r] {
+				consumers[r] = append(consumers[r], c)
+				basal[c] = false
+			}
+		}
+	}
+
+	chains := make([]int, 0)
+	visited := make([]bool, n)
+	var follow func(i, length int)
+	follow = func(i, length int) {
+		if len(chains) >= maxFoodChains {
+			return
+		}
+		if len(consumers[i]) == 0 {
+			if length > 0 {
+				chains = append(chains, length)
+			}
+			return
+		}
+
+		visited[i] = true
+		for _, c := range consumers[i] {
+			if !visited[c] {
+				follow(c, length+1)
+			}
+		}
+		visited[i] = false
+	}
+
+	for i := 0; i < n; i++ {
+		if basal[i] {
+			follow(i, 0)
+		}
+	}
+
+	return chains, len(chains) >= maxFoodChains
+}
+
+// Modules() takes a FoodWeb, and returns a module of every species and the modularity Q of this partition of the
+// undirected trophic links, found by greedily merging the pair of modules that increases Q the most until none does.
+func Modules(web FoodWeb) ([]int, float64) {
+	n := len(web.names)
+
+	// e[a][b] is the fraction of link ends between modules a and b, and degree[a] the fraction of link ends in module a
+	e := make([][]float64, n)
+	degree := make([]float64, n)
+	numLinks := 0
+	for i := 0; i < n; i++ {
+		e[i] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			if web.eats[i][j] || web.eats[j][i] {
+				e[i][j] = 1
+				numLinks++
+			}
+		}
+	}
+
+	modules := make([]int, n)
+	for i := range modules {
+		modules[i] = i
+	}
+	if numLinks == 0 {
+		return modules, 0
+	}
+
+	alive := make([]bool, n)
+	for a := 0; a < n; a++ {
+		alive[a] = true
+		for b := 0; b < n; b++ {
+			e[a][b] /= float64(numLinks)
+			degree[a] += e[a][b]
+		}
+	}
+
+	modularity := 0.0
+	for a := 0; a < n; a++ {
+		modularity += e[a][a] - degree[a]*degree[a]
+	}
+
+	for {
+		bestGain, bestA, bestB := 0.0, -1, -1
+		for a := 0; a < n; a++ {
+			for b := a + 1; b < n; b++ {
+				if !alive[a] || !alive[b] || e[a][b] == 0 {
+					continue
+				}
+				if gain := 2 * (e[a][b] - degree[a]*degree[b]); gain > bestGain {
+					bestGain, bestA, bestB = gain, a, b
+				}
+			}
+		}
+		if bestA < 0 {
+			break
+		}
+
+		// merge module bestB into module bestA
+		for c := 0; c < n; c++ {
+			if c != bestA && c != bestB {
+				e[bestA][c] += e[bestB][c]
+				e[c][bestA] = e[bestA][c]
+			}
+		}
+		e[bestA][bestA] += e[bestB][bestB] + 2*e[bestA][bestB]
+		e[bestA][bestB], e[bestB][bestA] = 0, 0
+		degree[bestA] += degree[bestB]
+		alive[bestB] = false
+		for i := range modules {
+			if modules[i] == bestB {
+				modules[i] = bestA
+			}
+		}
+		modularity += bestGain
+	}
+
+	// number the modules 0, 1, 2, ... in order of their first species
+	numbers := make(map[int]int)
+	for i, module := range modules {
+		if _, ok := numbers[module]; !ok {
+			numbers[module] = len(numbers)
+		}
+		modules[i] = numbers[module]
+	}
+
+	return modules, modularity
+}
+
+// Nestedness() takes a FoodWeb, and returns the NODF nestedness of its consumer-resource matrix, with one row per consumer
+// and one column per resource: the mean, over all pairs of rows and all pairs of columns, of the percentage of the links
+// of the one with fewer links that the other shares, counting 0 for pairs with the same number of links.
+func Nestedness(web FoodWeb) float64 {
+	n := len(web.names)
+	consumers, resources := make([]int, 0), make([]int, 0)
+	for i := 0; i < n; i++ {
+		isConsumer, isResource := false, false
+		for j := 0; j < n; j++ {
+			isConsumer = isConsumer || web.eats[i][j]
+			isResource = isResource || web.eats[j][i]
+		}
+		if isConsumer {
+			consumers = append(consumers, i)
+		}
+		if isResource {
+			resources = append(resources, i)
+		}
+	}
+
+	// pairNODF() returns the sum of the paired overlaps of a set of rows and the number of pairs
+	pairNODF := func(rows, columns []int, link func(row, column int) bool) (float64, int) {
+		total, pairs := 0.0, 0
+		for a := 0; a < len(rows); a++ {
+			for b := a + 1; b < len(rows); b++ {
+				degreeA, degreeB, shared := 0, 0, 0
+				for _, column := range columns {
+					la, lb := link(rows[a], column), link(rows[b], column)
+					if la {
+						degreeA++
+					}
+					if lb {
+						degreeB++
+					}
+					if la && lb {
+						shared++
+					}
+				}
+				if degreeA != degreeB && min(degreeA, degreeB) > 0 {
+					total += 100 * float64(shared) / float64(min(degreeA, degreeB))
+				}
+				pairs++
+			}
+		}
+		return total, pairs
+	}
+
+	rowTotal, rowPairs := pairNODF(consumers, resources, func(c, r int) bool { return web.eats[c][r] })
+	columnTotal, columnPairs := pairNODF(resources, consumers, func(r, c int) bool { return web.eats[c][r] })
+	if rowPairs+columnPairs == 0 {
+		return 0
+	}
+
+	return (rowTotal + columnTotal) / float64(rowPairs+columnPairs)
+}
+
+// AnalyzeFoodWeb() takes a FoodWeb, and returns its FoodWebMetrics.
+func AnalyzeFoodWeb(web FoodWeb) FoodWebMetrics {
+	n := len(web.names)
+	metrics := FoodWebMetrics{species: n}
+
+	numConsumers, numOmnivores := 0, 0
+	metrics.trophicLevels = TrophicLevels(web)
+	metrics.omnivory = OmnivoryIndex(web, metrics.trophicLevels)
+	for c := 0; c < n; c++ {
+		prey := 0
+		for r := 0; r < n; r++ {
+			if web.eats[c][r] {
+				prey++
+			}
+		}
+		metrics.links += prey
+		if prey > 0 {
+			numConsumers++
+			if metrics.omnivory[c] > 1e-6 {
+				numOmnivores++
+			}
+		}
+	}
+	metrics.connectance = float64(metrics.links) / float64(n*n)
+	if numConsumers > 0 {
+		metrics.omnivoreShare = float64(numOmnivores) / float64(numConsumers)
+	}
+
+	chains, truncated := EnumerateFoodChains(web)
+	metrics.numChains, metrics.chainsTruncated = len(chains), truncated
+	for _, length := range chains {
+		metrics.meanChain += float64(length) / float64(len(chains))
+		metrics.maxChain = max(metrics.maxChain, length)
+	}
+
+	metrics.modules, metrics.modularity = Modules(web)
+	metrics.nestedness = Nestedness(web)
+
+	return metrics
+}
+
+// PrintFoodWebMetrics() prints the metrics of a food web.
+func PrintFoodWebMetrics(metrics FoodWebMetrics) {
+	fmt.Printf("Species: %d, trophic links: %d, connectance: %.3f\n", metrics.species, metrics.links, metrics.connectance)
+	fmt.Printf("Omnivores: %.0f%% of the consumers\n", 100*metrics.omnivoreShare)
+
+	chains := strconv.Itoa(metrics.numChains)
+	if metrics.chainsTruncated {
+		chains = "more than " + chains
+	}
+	fmt.Printf("Food chains: %s, mean length %.2f, longest %d links\n", chains, metrics.meanChain, metrics.maxChain)
+
+	numModules := 0
+	for _, module := range metrics.modules {
+		numModules = max(numModules, module+1)
+	}
+	fmt.Printf("Modules: %d, modularity Q = %.3f\n", numModules, metrics.modularity)
+	fmt.Printf("Nestedness (NODF): %.1f\n", metrics.nestedness)
+}
+
+// WriteFoodWebCSV() writes the trophic level, number of prey and predators, omnivory index and module of every species
+// of a food web to a CSV file.
+func WriteFoodWebCSV(web FoodWeb, metrics FoodWebMetrics, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Species", "Trophic level", "Prey", "Predators", "Omnivory index", "Module"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for i, name := range web.names {
+		prey, predators := 0, 0
+		for j := range web.names {
+			if web.eats[i][j] {
+				prey++
+			}
+			if web.eats[j][i] {
+				predators++
+			}
+		}
+
+		row := []string{
+			name,
+			strconv.FormatFloat(metrics.trophicLevels[i], 'f', -1, 64),
+			strconv.Itoa(prey),
+			strconv.Itoa(predators),
+			strconv.FormatFloat(metrics.omnivory[i], 'f', -1, 64),
+			strconv.Itoa(metrics.modules[i]),
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// WriteFoodWebDOT() writes a food web to a Graphviz DOT file. Every nonzero effect a_ij of species j on species i
+// is an edge from j to i labeled with its coefficient: blue for positive and red for negative effects, solid for trophic
+// links and dashed for the other interactions, with a width growing with the strength of the effect.
+// The species are ranked from the bottom by trophic level.
+func WriteFoodWebDOT(web FoodWeb, metrics FoodWebMetrics, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	n := len(web.names)
+	strongest := 0.0
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i != j {
+				strongest = math.Max(strongest, math.Abs(web.interaction.At(i, j)))
+			}
+		}
+	}
+
+	var dot strings.Builder
+	dot.WriteString("digraph foodweb {\n\trankdir=BT;\n\tnode [shape=ellipse];\n")
+	for i, name := range web.names {
+		fmt.Fprintf(&dot, "\tn%d [label=%s];\n", i, strconv.Quote(fmt.Sprintf("%s\nTL %.2f", name, metrics.trophicLevels[i])))
+	}
+
+	// species of about the same trophic level share a rank
+	ranks := make(map[int][]int)
+	for i, level := range metrics.trophicLevels {
+		if !math.IsNaN(level) {
+			ranks[int(math.Round(level))] = append(ranks[int(math.Round(level))], i)
+		}
+	}
+	levels := make([]int, 0, len(ranks))
+	for level := range ranks {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		dot.WriteString("\t{rank=same;")
+		for _, i := range ranks[level] {
+			fmt.Fprintf(&dot, " n%d;", i)
+		}
+		dot.WriteString("}\n")
+	}
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			coefficient := web.interaction.At(i, j)
+			if i == j || coefficient == 0 {
+				continue
+			}
+			edgeColor, style := "blue", "solid"
+			if coefficient < 0 {
+				edgeColor = "red"
+			}
+			if InteractionType(web, i, j) != "trophic" {
+				style = "dashed"
+			}
+			fmt.Fprintf(&dot, "\tn%d -> n%d [label=\"%.3g\", weight=%g, color=%s, style=%s, penwidth=%.2f];\n",
+				j, i, coefficient, math.Abs(coefficient), edgeColor, style, 0.5+2.5*math.Abs(coefficient)/strongest)
+		}
+	}
+	dot.WriteString("}\n")
+
+	if _, err := file.WriteString(dot.String()); err != nil {
+		fmt.Println("Error writing DOT file:", err)
+	}
+}
+
+// WriteFoodWebGraphML() writes a food web to a GraphML file, with the name, trophic level, omnivory index and module
+// of every species, and one directed edge from j to i for every nonzero effect a_ij with its weight, sign and
+// interaction type.
+func WriteFoodWebGraphML(web FoodWeb, metrics FoodWebMetrics, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	escape := func(text string) string {
+		var escaped strings.Builder
+		xml.EscapeText(&escaped, []byte(text))
+		return escaped.String()
+	}
+
+	var graph strings.Builder
+	graph.WriteString(xml.Header)
+	graph.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	graph.WriteString(`  <key id="name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	graph.WriteString(`  <key id="level" for="node" attr.name="trophicLevel" attr.type="double"/>` + "\n")
+	graph.WriteString(`  <key id="omnivory" for="node" attr.name="omnivory" attr.type="double"/>` + "\n")
+	graph.WriteString(`  <key id="module" for="node" attr.name="module" attr.type="int"/>` + "\n")
+	graph.WriteString(`  <key id="weight" for="edge" attr.name="weight" attr.type="double"/>` + "\n")
+	graph.WriteString(`  <key id="sign" for="edge" attr.name="sign" attr.type="string"/>` + "\n")
+	graph.WriteString(`  <key id="type" for="edge" attr.name="type" attr.type="string"/>` + "\n")
+	graph.WriteString(`  <graph id="foodweb" edgedefault="directed">` + "\n")
+
+	for i, name := range web.names {
+		fmt.Fprintf(&graph, "    <node id=\"n%d\">\n", i)
+		fmt.Fprintf(&graph, "      <data key=\"name\">%s</data>\n", escape(name))
+		fmt.Fprintf(&graph, "      <data key=\"level\">%g</data>\n", metrics.trophicLevels[i])
+		fmt.Fprintf(&graph, "      <data key=\"omnivory\">%g</data>\n", metrics.omnivory[i])
+		fmt.Fprintf(&graph, "      <data key=\"module\">%d</data>\n", metrics.modules[i])
+		graph.WriteString("    </node>\n")
+	}
+
+	for i := range web.names {
+		for j := range web.names {
+			coefficient := web.interaction.At(i, j)
+			if i == j || coefficient == 0 {
+				continue
+			}
+			edgeSign := "+"
+			if coefficient < 0 {
+				edgeSign = "-"
+			}
+			fmt.Fprintf(&graph, "    <edge source=\"n%d\" target=\"n%d\">\n", j, i)
+			fmt.Fprintf(&graph, "      <data key=\"weight\">%g</data>\n", coefficient)
+			fmt.Fprintf(&graph, "      <data key=\"sign\">%s</data>\n", edgeSign)
+			fmt.Fprintf(&graph, "      <data key=\"type\">%s</data>\n", InteractionType(web, i, j))
+			graph.WriteString("    </edge>\n")
+		}
+	}
+	graph.WriteString("  </graph>\n</graphml>\n")
+
+	if _, err := file.WriteString(graph.String()); err != nil {
+		fmt.Println("Error writing GraphML file:", err)
+	}
+}
+
+// FoodWebCommand infers the food web of a scenario file or preset from the signs of its interaction matrix,
+// prints its metrics, and writes them to ./output/<name>_foodweb.csv with the web as ./output/<name>_foodweb.dot
+// and ./output/<name>_foodweb.graphml.
+func FoodWebCommand(args []string) {
+	flags := flag.NewFlagSet("foodweb", flag.ExitOnError)
+	name := flags.String("name", "", "name of the output files (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the foodweb command takes the name of a scenario file or preset.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	settings := ScenarioSettings(scenario)
+	if *name != "" {
+		settings.name = *name
+	}
+
+	web := InferFoodWeb(BuildEcosystem(scenario))
+	metrics := AnalyzeFoodWeb(web)
+	PrintFoodWebMetrics(metrics)
+
+	filename := "./output/" + settings.name + "_foodweb"
+	WriteFoodWebCSV(web, metrics, filename+".csv")
+	WriteFoodWebDOT(web, metrics, filename+".dot")
+	WriteFoodWebGraphML(web, metrics, filename+".graphml")
+	fmt.Println("Food web written to " + filename + ".csv, .dot and .graphml")
+}
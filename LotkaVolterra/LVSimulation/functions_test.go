@@ -3,7 +3,11 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"image/color"
+	"image/gif"
 	"io/fs"
+	"math"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -484,3 +488,788 @@ func ReadSpeciesArray(file string) []*Specie {
 
 	return speciesArray
 }
+
+// TestPeakPeriod tests the PeakPeriod() and SpectralPeriod() functions on sine waves with known periods
+func TestPeakPeriod(t *testing.T) {
+	time := 0.01
+	for _, period := range []float64{1.0, 2.5, 4.0} {
+		series := make([]float64, 2000)
+		for i := range series {
+			series[i] = 2 + math.Sin(2*math.Pi*float64(i)*time/period)
+		}
+
+		peak := PeakPeriod(series, time)
+		if peak == nil || math.Abs(*peak-period) > 0.02 {
+			t.Errorf("PeakPeriod() = %v, want %v", peak, period)
+		}
+
+		spectral := SpectralPeriod(series, time)
+		if spectral == nil || math.Abs(*spectral-period)/period > 0.05 {
+			t.Errorf("SpectralPeriod() = %v, want %v", spectral, period)
+		}
+	}
+
+	// a constant series has no period
+	constant := []float64{1, 1, 1, 1, 1, 1}
+	if PeakPeriod(constant, time) != nil || SpectralPeriod(constant, time) != nil {
+		t.Errorf("constant series should have no period")
+	}
+}
+
+// TestExtinctionTime tests the ExtinctionTime() function
+func TestExtinctionTime(t *testing.T) {
+	tests := []struct {
+		series   []float64
+		expected float64 // -1 means no extinction
+	}{
+		{[]float64{1, 0.5, 0.1, 0.01}, -1},
+		{[]float64{1, 0.5, 0, 0}, 2},
+		{[]float64{1, 0, 0.5, 0, 0}, 3},
+	}
+
+	for _, test := range tests {
+		result := ExtinctionTime(test.series, 1)
+		if test.expected < 0 && result != nil {
+			t.Errorf("ExtinctionTime(%v) = %v, want nil", test.series, *result)
+		}
+		if test.expected >= 0 && (result == nil || *result != test.expected) {
+			t.Errorf("ExtinctionTime(%v) = %v, want %v", test.series, result, test.expected)
+		}
+	}
+}
+
+// TestCompetitionEquilibrium tests InteriorEquilibrium() and CoexistenceReport() on two-species competitive LV models
+func TestCompetitionEquilibrium(t *testing.T) {
+	tests := []struct {
+		alpha    []float64
+		expected []float64 // interior equilibrium with K = (100, 80)
+		outcome  string
+		winner   int
+	}{
+		{[]float64{1, 0.5, 0.6, 1}, []float64{60.0 / 0.7, 20.0 / 0.7}, "coexistence", -1},
+		{[]float64{1, 2, 0.6, 1}, []float64{300, -100}, "exclusion", 1},
+	}
+
+	for _, test := range tests {
+		params := CompetitionParameters{
+			growth:   []float64{1, 0.8},
+			capacity: []float64{100, 80},
+			alpha:    mat.NewDense(2, 2, test.alpha),
+		}
+		ecosystem := InitializeCompetitiveEcosystem(2, []float64{1, 1}, nil, params)
+
+		x, ok := InteriorEquilibrium(ecosystem)
+		if !ok || math.Abs(x[0]-test.expected[0]) > 1e-6 || math.Abs(x[1]-test.expected[1]) > 1e-6 {
+			t.Errorf("InteriorEquilibrium() = %v, want %v", x, test.expected)
+		}
+
+		report := CoexistenceReport(params)
+		if report[0].outcome != test.outcome || report[0].winner != test.winner {
+			t.Errorf("CoexistenceReport() = %s (winner %d), want %s (winner %d)", report[0].outcome, report[0].winner, test.outcome, test.winner)
+		}
+	}
+}
+
+// TestBuildStageTransfer tests BuildStageTransfer() and AggregateStages() on a species with two stages
+func TestBuildStageTransfer(t *testing.T) {
+	species := []*Specie{
+		{index: 0, name: "Hare", stage: "juvenile", population: 3},
+		{index: 1, name: "Hare", stage: "adult", population: 2},
+		{index: 2, name: "Lynx", population: 1},
+	}
+	transitions := []StageTransition{
+		{Species: "Hare", From: "juvenile", To: "adult", Rate: 0.5, Type: "maturation"},
+		{Species: "Hare", From: "adult", To: "juvenile", Rate: 2, Type: "reproduction"},
+	}
+
+	expected := mat.NewDense(3, 3, []float64{
+		-0.5, 2, 0,
+		0.5, 0, 0,
+		0, 0, 0,
+	})
+	result := BuildStageTransfer(species, transitions)
+	if !mat.Equal(result, expected) {
+		t.Errorf("BuildStageTransfer() = %v, want %v", mat.Formatted(result), mat.Formatted(expected))
+	}
+
+	aggregated := AggregateStages([]*Ecosystem{{species: species}})
+	if len(aggregated[0].species) != 2 || aggregated[0].species[0].population != 5 || aggregated[0].species[1].population != 1 {
+		t.Errorf("AggregateStages() did not sum the stages of each species")
+	}
+}
+
+// TestSimulateDelayEcosystem tests that SimulateDelayEcosystem() with zero delays matches SimulateEcosystem(),
+// and that a delayed interaction uses the history before t = 0
+func TestSimulateDelayEcosystem(t *testing.T) {
+	interaction := mat.NewDense(2, 2, []float64{-0.01, -0.02, 0.01, 0})
+	deathGrowth := SetRateMatrix([]float64{1, -0.5})
+	ecosystem := InitializeEcosystem(2, []float64{40, 20}, nil, interaction, deathGrowth)
+
+	plain := SimulateEcosystem(ecosystem, 500, 0.01)
+
+	ecosystem.delay = mat.NewDense(2, 2, nil)
+	delayed := SimulateDelayEcosystem(ecosystem, 500, 0.01, nil)
+
+	for i := range plain {
+		for j := 0; j < 2; j++ {
+			if math.Abs(plain[i].species[j].population-delayed[i].species[j].population) > 1e-9 {
+				t.Fatalf("SimulateDelayEcosystem() with zero delays differs from SimulateEcosystem() at step %d", i)
+			}
+		}
+	}
+
+	// with a delay of one time unit, the first steps of the predator only see the history of the prey
+	ecosystem.delay = mat.NewDense(2, 2, []float64{0, 0, 1, 0})
+	history := func(t float64, index int) float64 { return 0 }
+	delayed = SimulateDelayEcosystem(ecosystem, 10, 0.01, history)
+
+	expected := 20 * math.Pow(1-0.5*0.01, 10)
+	if math.Abs(delayed[10].species[1].population-expected) > 1e-9 {
+		t.Errorf("delayed predator population = %v, want %v", delayed[10].species[1].population, expected)
+	}
+}
+
+// TestDelayState tests that a DelayState, which only keeps the time points its delays need,
+// follows SimulateDelayEcosystem() step by step with a history that is not constant
+func TestDelayState(t *testing.T) {
+	interaction := mat.NewDense(2, 2, []float64{-0.01, -0.02, 0.01, 0})
+	deathGrowth := SetRateMatrix([]float64{1, -0.5})
+	ecosystem := InitializeEcosystem(2, []float64{40, 20}, nil, interaction, deathGrowth)
+	ecosystem.delay = mat.NewDense(2, 2, []float64{0, 0, 1, 0})
+	history := func(t float64, index int) float64 { return 40 + 10*t }
+
+	full := SimulateDelayEcosystem(ecosystem, 1000, 0.01, history)
+	state := InitializeDelayState(ecosystem, 0.01, history)
+	for step := 1; step <= 1000; step++ {
+		StepDelayState(state)
+		for j := 0; j < 2; j++ {
+			if state.pop[j] != full[step].species[j].population {
+				t.Fatalf("step %d: DelayState gives %v for species %d, SimulateDelayEcosystem() gives %v",
+					step, state.pop[j], j, full[step].species[j].population)
+			}
+		}
+	}
+	if len(state.past) >= 2*state.keep {
+		t.Errorf("DelayState keeps %d time points, want fewer than %d", len(state.past), 2*state.keep)
+	}
+
+	// the sampled run keeps every 100th time point, and its time points share the matrices of the initial ecosystem
+	sampled := SimulateDelayEcosystemSampled(ecosystem, 1000, 0.01, history, 100)
+	if len(sampled) != 11 {
+		t.Fatalf("SimulateDelayEcosystemSampled() returns %d time points, want 11", len(sampled))
+	}
+	for k, timePoint := range sampled {
+		for j := 0; j < 2; j++ {
+			if timePoint.species[j].population != full[100*k].species[j].population {
+				t.Errorf("sampled time point %d gives %v for species %d, want %v", k, timePoint.species[j].population, j, full[100*k].species[j].population)
+			}
+		}
+		if timePoint.interaction != ecosystem.interaction {
+			t.Errorf("sampled time point %d has its own copy of the interaction matrix", k)
+		}
+	}
+}
+
+// TestInferGLV tests that InferGLV() recovers the growth rates and interactions of a simulated two-species gLV model
+func TestInferGLV(t *testing.T) {
+	interaction := mat.NewDense(2, 2, []float64{-0.01, -0.02, 0.01, -0.005})
+	deathGrowth := SetRateMatrix([]float64{1, -0.3})
+	ecosystem := InitializeEcosystem(2, []float64{40, 5}, nil, interaction, deathGrowth)
+
+	time := 0.01
+	timePoints := SimulateEcosystem(ecosystem, 2000, time)
+
+	series := TimeSeries{names: []string{"Prey", "Predator"}}
+	for i, point := range timePoints {
+		series.times = append(series.times, float64(i)*time)
+		series.data = append(series.data, []float64{point.species[0].population, point.species[1].population})
+	}
+
+	settings := InferenceSettings{alpha: 1, numFolds: 5, numLambdas: 10, numBootstrap: 5}
+	growth, inferred, _ := InferGLV([]TimeSeries{series}, settings)
+
+	expectedGrowth := []float64{1, -0.3}
+	for i := 0; i < 2; i++ {
+		if math.Abs(growth[i]-expectedGrowth[i]) > 0.01 {
+			t.Errorf("InferGLV() growth[%d] = %v, want %v", i, growth[i], expectedGrowth[i])
+		}
+	}
+	if !mat.EqualApprox(inferred, interaction, 1e-3) {
+		t.Errorf("InferGLV() interaction = %v, want %v", mat.Formatted(inferred), mat.Formatted(interaction))
+	}
+}
+
+// TestInferredScenario tests that the scenario of an unevenly sampled series covers its whole time span,
+// and that replaying it reproduces the series it was simulated from at every observed time
+func TestInferredScenario(t *testing.T) {
+	interaction := mat.NewDense(2, 2, []float64{-0.01, -0.02, 0.01, -0.005})
+	growth := []float64{1, -0.3}
+	ecosystem := InitializeEcosystem(2, []float64{40, 5}, nil, interaction, SetRateMatrix(growth))
+	timePoints := SimulateEcosystem(ecosystem, 500, 0.002)
+
+	series := TimeSeries{names: []string{"Prey", "Predator"}}
+	for _, step := range []int{0, 5, 15, 20, 100, 500} {
+		series.times = append(series.times, float64(step)*0.002)
+		series.data = append(series.data, []float64{timePoints[step].species[0].population, timePoints[step].species[1].population})
+	}
+
+	scenario := InferredScenario(series, growth, interaction, "uneven")
+	if math.Abs(scenario.Time-0.002) > 1e-12 || scenario.NumGens != 500 {
+		t.Fatalf("time interval %v and %d generations, want 0.002 and 500", scenario.Time, scenario.NumGens)
+	}
+
+	replayed := SimulateEcosystem(BuildEcosystem(scenario), scenario.NumGens, scenario.Time)
+	for i, e := range ReplayError(series, replayed, scenario.Time) {
+		if e > 1e-9 {
+			t.Errorf("replay RMSE of species %d is %v, want 0", i, e)
+		}
+	}
+}
+
+// TestSimulateSparseEcosystem tests that a sparse interaction matrix gives the same trajectory as the dense one,
+// and that both match the original update of UpdateEcosystem
+func TestSimulateSparseEcosystem(t *testing.T) {
+	sparse := InitializeSparseInteractionMatrix(50, 0.1)
+	dense := mat.DenseCopyOf(sparse)
+	pop := make([]float64, 50)
+	rates := make([]float64, 50)
+	for i := range pop {
+		pop[i] = 0.5
+		rates[i] = 1
+	}
+
+	sparseEcosystem := InitializeEcosystem(50, pop, nil, sparse, SetRateMatrix(rates))
+	denseEcosystem := InitializeEcosystem(50, pop, nil, dense, SetRateMatrix(rates))
+
+	sparsePoints := SimulateEcosystem(sparseEcosystem, 100, 0.01)
+	densePoints := SimulateEcosystem(denseEcosystem, 100, 0.01)
+
+	original := denseEcosystem
+	for i := 0; i < 100; i++ {
+		original = UpdateEcosystem(original, 0.01)
+	}
+
+	for i := 0; i < 50; i++ {
+		s := sparsePoints[100].species[i].population
+		d := densePoints[100].species[i].population
+		o := original.species[i].population
+		if math.Abs(s-d) > 1e-12 || math.Abs(d-o) > 1e-12 {
+			t.Errorf("species %d: sparse %v, dense %v, original %v", i, s, d, o)
+		}
+	}
+
+	sampled := SimulateEcosystemSampled(sparseEcosystem, 100, 0.01, 25)
+	if len(sampled) != 5 || sampled[4].species[0].population != sparsePoints[100].species[0].population {
+		t.Errorf("SimulateEcosystemSampled() kept %d time points, want 5 ending with the last one", len(sampled))
+	}
+}
+
+// BenchmarkSimulateEcosystem compares the dense and sparse engines on random communities with a connectance of 0.05
+func BenchmarkSimulateEcosystem(b *testing.B) {
+	for _, numSpecies := range []int{100, 1000, 2000} {
+		sparse := InitializeSparseInteractionMatrix(numSpecies, 0.05)
+		pop := make([]float64, numSpecies)
+		rates := make([]float64, numSpecies)
+		for i := range pop {
+			pop[i] = 0.5
+			rates[i] = 1
+		}
+
+		interactions := map[string]mat.Matrix{"dense": mat.DenseCopyOf(sparse), "sparse": sparse}
+		for _, format := range []string{"dense", "sparse"} {
+			ecosystem := InitializeEcosystem(numSpecies, pop, nil, interactions[format], SetRateMatrix(rates))
+			b.Run(fmt.Sprintf("%s/%d", format, numSpecies), func(b *testing.B) {
+				for k := 0; k < b.N; k++ {
+					SimulateEcosystemSampled(ecosystem, 100, 0.001, 100)
+				}
+			})
+		}
+
+		// the original update rebuilds dense matrices every step
+		ecosystem := InitializeEcosystem(numSpecies, pop, nil, interactions["dense"], SetRateMatrix(rates))
+		b.Run(fmt.Sprintf("original/%d", numSpecies), func(b *testing.B) {
+			for k := 0; k < b.N; k++ {
+				current := ecosystem
+				for i := 0; i < 100; i++ {
+					current = UpdateEcosystem(current, 0.001)
+				}
+			}
+		})
+	}
+}
+
+// TestClassifyFinalState tests that the two basins of the extinction-two preset end with different survivors
+func TestClassifyFinalState(t *testing.T) {
+	settings := DefaultSettings("test")
+	settings.sampleEvery = 100
+
+	for _, test := range []struct {
+		x, y     float64
+		survivor int
+	}{{4, 1, 0}, {1, 4, 1}} {
+		ecosystem := BuildEcosystem(presets["extinction-two"])
+		ecosystem.species[0].population = test.x
+		ecosystem.species[1].population = test.y
+
+		state := ClassifyFinalState(SimulateWithSettings(ecosystem, settings), 1e-3)
+		if len(state.survivors) != 1 || state.survivors[0] != test.survivor || state.dynamics != "equilibrium" {
+			t.Errorf("ClassifyFinalState() from (%v, %v) = %v, want species %d at an equilibrium", test.x, test.y, state, test.survivor)
+		}
+	}
+}
+
+// TestDetectBifurcations tests that continuing the stable preset in a_00 finds the Hopf bifurcation
+// between the stable and limit-cycle presets, with a pair of eigenvalues on the imaginary axis
+func TestDetectBifurcations(t *testing.T) {
+	ecosystem := BuildEcosystem(presets["stable"])
+	x0, _ := InteriorEquilibrium(ecosystem)
+	settings := ContinuationSettings{
+		parameter: ParseContinuationParameter("a:0:0", 3),
+		minValue:  -2.5,
+		maxValue:  -0.4,
+		step:      0.01,
+		maxStep:   0.05,
+		maxPoints: 1000,
+	}
+
+	branch := FullBranch(ecosystem, x0, settings)
+	bifurcations := DetectBifurcations(ecosystem, settings.parameter, branch)
+
+	if len(bifurcations) != 1 || bifurcations[0].kind != "hopf" {
+		t.Fatalf("DetectBifurcations() = %v, want one Hopf bifurcation", bifurcations)
+	}
+	hopf := bifurcations[0]
+	if hopf.parameter < -2 || hopf.parameter > -0.5 {
+		t.Errorf("Hopf bifurcation at a_00 = %v, want between the stable (-2) and limit-cycle (-0.5) presets", hopf.parameter)
+	}
+	if HopfFrequency(SetParameter(ecosystem, settings.parameter, hopf.parameter), hopf.populations) == 0 {
+		t.Errorf("no eigenvalues on the imaginary axis at the Hopf bifurcation")
+	}
+}
+
+// TestInterpolateCrossing tests that a crossing of a section is only recorded in its direction,
+// and is interpolated to where the section's species has the section's value
+func TestInterpolateCrossing(t *testing.T) {
+	section := PoincareSection{species: 0, value: 1, direction: 1}
+	before, after := []float64{0.5, 2}, []float64{1.5, 4}
+
+	if !CrossesSection(section, before[0], after[0]) || CrossesSection(section, after[0], before[0]) {
+		t.Errorf("CrossesSection() does not respect the direction of the section")
+	}
+
+	crossing := InterpolateCrossing(section, 10, 12, before, after)
+	if crossing.time != 11 || crossing.populations[0] != 1 || crossing.populations[1] != 3 {
+		t.Errorf("InterpolateCrossing() = %v, want time 11 and populations [1 3]", crossing)
+	}
+}
+
+// TestAssembleCommunity tests that every step of an assembly sequence keeps a consistent community:
+// no species twice, no species below the extinction threshold, and the invader present exactly when it established
+func TestAssembleCommunity(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pool := GenerateSpeciesPool(PoolSettings{size: 20, producerFraction: 0.5, connectance: 0.3, strength: 0.5, efficiency: 0.5, selfLimitation: 1}, rng)
+	settings := AssemblySettings{steps: 30, invasionDensity: 0.01, numGens: 5000, time: 0.01, threshold: 1e-4}
+
+	for k, step := range AssembleCommunity(pool, settings, rng) {
+		present := make(map[int]bool)
+		for a, i := range step.community {
+			if present[i] {
+				t.Errorf("step %d: species %d twice in the community", k, i)
+			}
+			present[i] = true
+			if step.populations[a] <= settings.threshold {
+				t.Errorf("step %d: species %d kept below the extinction threshold", k, i)
+			}
+		}
+		if present[step.invader] != step.established {
+			t.Errorf("step %d: invader %d established = %v, but present = %v", k, step.invader, step.established, present[step.invader])
+		}
+	}
+}
+
+// TestMergeLineages tests that a lineage within the resolution of a more abundant one is merged into it,
+// and that a lineage further away is kept
+func TestMergeLineages(t *testing.T) {
+	lineages := []Lineage{
+		{id: 0, trait: 0, population: 1, extinction: -1},
+		{id: 1, trait: 0.005, population: 0.1, extinction: -1},
+		{id: 2, trait: 0.5, population: 0.2, extinction: -1},
+	}
+
+	living := MergeLineages(lineages, []int{0, 1, 2}, 0.01, 10)
+	if len(living) != 2 || living[0] != 0 || living[1] != 2 {
+		t.Errorf("MergeLineages() = %v, want [0 2]", living)
+	}
+	if lineages[0].population != 1.1 || lineages[1].extinction != 10 || lineages[2].extinction != -1 {
+		t.Errorf("MergeLineages() left lineages %v", lineages)
+	}
+}
+
+// TestCompareTrajectories tests that CompareTrajectories() reports the maximum errors of every species
+// and the first generation out of tolerance
+func TestCompareTrajectories(t *testing.T) {
+	reference := TimeSeries{names: []string{"A", "B"}, data: [][]float64{{1, 2}, {1, 2}, {1, 2}}}
+	timePoints := make([]*Ecosystem, 3)
+	for k, pops := range [][]float64{{1, 2}, {1.001, 2}, {1, 2.5}} {
+		timePoints[k] = &Ecosystem{species: []*Specie{{index: 0, population: pops[0]}, {index: 1, population: pops[1]}}}
+	}
+
+	result := CompareTrajectories(timePoints, reference, Tolerance{absolute: 0.01, relative: 0})
+	if result.firstDivergence != 2 || result.divergingSpecies != 1 {
+		t.Errorf("first divergence at generation %d in species %d, want generation 2 in species 1", result.firstDivergence, result.divergingSpecies)
+	}
+	if math.Abs(result.maxAbsError[0]-0.001) > 1e-12 || result.maxRelError[1] != 0.25 {
+		t.Errorf("maximum errors %v and %v, want 0.001 for A and a relative error of 0.25 for B", result.maxAbsError, result.maxRelError)
+	}
+}
+
+// TestSparkline tests that a sparkline has one character per value, from the lowest level at the minimum
+// to the highest level at the maximum
+func TestSparkline(t *testing.T) {
+	if line := Sparkline([]float64{1, 2, 3, 2, 1}); line != "▁▄█▄▁" {
+		t.Errorf("Sparkline() = %s, want ▁▄█▄▁", line)
+	}
+	if line := Sparkline([]float64{5, 5}); line != "▁▁" {
+		t.Errorf("Sparkline() of constant values = %s, want ▁▁", line)
+	}
+}
+
+// TestAnalyzeFoodWeb tests the food web of the original paper parameters: one prey eaten by two predators,
+// one of which also eats the other
+func TestAnalyzeFoodWeb(t *testing.T) {
+	web := InferFoodWeb(BuildEcosystem(presets["paper"]))
+	metrics := AnalyzeFoodWeb(web)
+
+	want := []float64{1, 2, 8.0 / 3}
+	for i, level := range metrics.trophicLevels {
+		if math.Abs(level-want[i]) > 1e-9 {
+			t.Errorf("trophic level of species %d = %v, want %v", i, level, want[i])
+		}
+	}
+	if metrics.links != 3 || metrics.numChains != 2 || metrics.maxChain != 2 {
+		t.Errorf("got %d links and %d chains of up to %d links, want 3 links and 2 chains of up to 2 links", metrics.links, metrics.numChains, metrics.maxChain)
+	}
+	if metrics.omnivory[1] != 0 || metrics.omnivory[2] <= 0 {
+		t.Errorf("omnivory indices %v, want only species 2 to be an omnivore", metrics.omnivory)
+	}
+}
+
+// TestRankRemovals tests that removals are ranked by their secondary extinctions first, then by the size of the biomass change,
+// with undefined biomass changes last
+func TestRankRemovals(t *testing.T) {
+	results := []RemovalResult{
+		{removed: 0, biomassChange: -0.5},
+		{removed: 4, biomassChange: math.NaN()},
+		{removed: 1, biomassChange: 0.1, secondary: []int{3}},
+		{removed: 2, biomassChange: 0.8},
+		{removed: 3, biomassChange: 0, secondary: []int{0, 2}},
+	}
+
+	RankRemovals(results)
+	for k, want := range []int{3, 1, 2, 0, 4} {
+		if results[k].removed != want {
+			t.Errorf("rank %d: removed species %d, want %d", k+1, results[k].removed, want)
+		}
+	}
+}
+
+// TestNetEffects tests that the net effects matrix predicts the shift of the interior equilibrium
+// after a small change of one growth rate, with pairwise and with higher-order interactions
+func TestNetEffects(t *testing.T) {
+	ecosystems := []*Ecosystem{
+		BuildEcosystem(presets["stable"]),
+		BuildEcosystem(ReadScenario("scenarios/interaction_modification.json")),
+	}
+	const delta = 1e-6
+	for k, ecosystem := range ecosystems {
+		before, _ := InteriorEquilibrium(ecosystem)
+		net, ok := NetEffects(ecosystem, before)
+		if !ok {
+			t.Fatalf("ecosystem %d: NetEffects() found the derivatives singular", k)
+		}
+
+		for j := range before {
+			parameter := ContinuationParameter{kind: "r", i: j}
+			after, _ := InteriorEquilibrium(SetParameter(ecosystem, parameter, ParameterValue(ecosystem, parameter)+delta))
+			for i := range before {
+				if response := (after[i] - before[i]) / delta; math.Abs(response-net.At(i, j)) > 1e-4*(1+math.Abs(response)) {
+					t.Errorf("ecosystem %d: species %d responds to species %d by %v, predicted %v", k, i, j, response, net.At(i, j))
+				}
+			}
+		}
+	}
+}
+
+// TestMeasureStability tests the stability measures of a normal and of a non-normal Jacobian,
+// where only the non-normal one amplifies perturbations before they decay
+func TestMeasureStability(t *testing.T) {
+	normal := MeasureStability(mat.NewDense(2, 2, []float64{-1, 0, 0, -2}))
+	if math.Abs(normal.resilience-1) > 1e-9 || math.Abs(normal.reactivity+1) > 1e-9 || math.Abs(normal.peakAmplification-1) > 1e-9 {
+		t.Errorf("diagonal Jacobian: resilience %v, reactivity %v, peak amplification %v, want 1, -1 and 1",
+			normal.resilience, normal.reactivity, normal.peakAmplification)
+	}
+
+	// the symmetric part [[-1, 2], [2, -2]] has the eigenvalue (-3 + sqrt(17)) / 2 > 0
+	nonNormal := MeasureStability(mat.NewDense(2, 2, []float64{-1, 4, 0, -2}))
+	if math.Abs(nonNormal.resilience-1) > 1e-9 {
+		t.Errorf("resilience %v, want 1", nonNormal.resilience)
+	}
+	if want := (-3 + math.Sqrt(17)) / 2; math.Abs(nonNormal.reactivity-want) > 1e-9 {
+		t.Errorf("reactivity %v, want %v", nonNormal.reactivity, want)
+	}
+	if nonNormal.peakAmplification <= 1 || nonNormal.peakTime <= 0 {
+		t.Errorf("peak amplification %v at t = %v, want a transient amplification above 1", nonNormal.peakAmplification, nonNormal.peakTime)
+	}
+}
+
+// TestFeasibilityDomain tests that without interspecific interactions the feasibility domain is the positive orthant:
+// it covers 1/2^n of the unit sphere, and r = (1, 1) lies 45 degrees away from its boundary
+func TestFeasibilityDomain(t *testing.T) {
+	interaction := mat.NewDense(2, 2, []float64{-1, 0, 0, -1})
+
+	domain, ok := SampleFeasibility(interaction, FeasibilitySettings{samples: 40000, workers: 4, seed: 1})
+	if !ok {
+		t.Fatalf("SampleFeasibility() found the interaction matrix singular")
+	}
+	if math.Abs(domain.feasible-0.25) > 4*domain.stdError || domain.stable != domain.feasible {
+		t.Errorf("feasible fraction %v, stable fraction %v, want 0.25 for both", domain.feasible, domain.stable)
+	}
+
+	distance, _ := DistanceToBoundary(interaction, []float64{1, 1})
+	if math.Abs(distance.angle-math.Pi/4) > 1e-12 {
+		t.Errorf("angle to boundary %v, want π/4", distance.angle)
+	}
+	outside, _ := DistanceToBoundary(interaction, []float64{1, -1})
+	if outside.angle >= 0 || outside.nearest != 1 {
+		t.Errorf("r = (1, -1): angle %v past species %d, want a negative angle past species 1", outside.angle, outside.nearest)
+	}
+}
+
+// TestDiscreteModels tests that the discrete-generation models stay at their known equilibria
+func TestDiscreteModels(t *testing.T) {
+	tests := []struct {
+		model       string
+		rates       []float64
+		interaction []float64
+		roles       []string
+		equilibrium []float64
+	}{
+		// Ricker and discrete LV: x* = K = -r / a
+		{"ricker", []float64{1.5}, []float64{-0.015}, []string{"producer"}, []float64{100}},
+		{"discrete-lv", []float64{0.5}, []float64{-0.005}, []string{"producer"}, []float64{100}},
+		// Beverton-Holt: x* = (λ - 1) / -a
+		{"beverton-holt", []float64{math.Log(3)}, []float64{-0.02}, []string{"producer"}, []float64{100}},
+		// Nicholson-Bailey: P* = ln λ / a, H* = λ ln λ / ((λ - 1) a c)
+		{"nicholson-bailey", []float64{math.Log(2), 0}, []float64{0, -0.05, 1, 0}, []string{"producer", "consumer"},
+			[]float64{2 * math.Log(2) / 0.05, math.Log(2) / 0.05}},
+	}
+
+	for _, test := range tests {
+		n := len(test.rates)
+		metadata := make([]SpeciesMetadata, n)
+		for i := range metadata {
+			metadata[i] = SpeciesMetadata{role: test.roles[i], color: []uint8{0, 0, 0}}
+		}
+		ecosystem := InitializeEcosystem(n, test.equilibrium, metadata, mat.NewDense(n, n, test.interaction), SetRateMatrix(test.rates))
+		ecosystem.model = test.model
+
+		timePoints := SimulateDiscrete(ecosystem, 5, 1)
+		for i, want := range test.equilibrium {
+			if got := timePoints[5].species[i].population; math.Abs(got-want) > 1e-9*want {
+				t.Errorf("%s: species %d at %v after 5 generations, want it to stay at %v", test.model, i, got, want)
+			}
+		}
+	}
+}
+
+// TestHigherOrderInteractions tests the equilibrium found by root finding with a shelter species halving predation,
+// the Jacobian against finite differences of the vector field, and that both integrators take the same step
+func TestHigherOrderInteractions(t *testing.T) {
+	scenario := ReadScenario("scenarios/interaction_modification.json")
+	ecosystem := BuildEcosystem(scenario)
+
+	// the shelter plant at its carrying capacity 25 halves the attack rate and the conversion of the predator
+	equilibrium, ok := InteriorEquilibrium(ecosystem)
+	if !ok {
+		t.Fatalf("InteriorEquilibrium() found no equilibrium")
+	}
+	for i, want := range []float64{50, 25, 25} {
+		if math.Abs(equilibrium[i]-want) > 1e-9 {
+			t.Errorf("equilibrium of species %d is %v, want %v", i, equilibrium[i], want)
+		}
+	}
+
+	x := []float64{30, 12, 7}
+	jacobian := Jacobian(ecosystem, x)
+	const h = 1e-6
+	for j := range x {
+		shifted := append([]float64(nil), x...)
+		shifted[j] += h
+		after, before := VectorField(ecosystem, shifted), VectorField(ecosystem, x)
+		for i := range x {
+			if numeric := (after[i] - before[i]) / h; math.Abs(numeric-jacobian.At(i, j)) > 1e-4 {
+				t.Errorf("Jacobian element (%d, %d) is %v, finite difference %v", i, j, jacobian.At(i, j), numeric)
+			}
+		}
+	}
+
+	state := InitializeLVState(ecosystem, 0.002)
+	StepLVState(state)
+	updated := UpdatePopulation(ecosystem, 0.002)
+	for i := range x {
+		if math.Abs(state.pop[i]-updated.At(i, 0)) > 1e-12 {
+			t.Errorf("species %d: StepLVState() gives %v, UpdatePopulation() gives %v", i, state.pop[i], updated.At(i, 0))
+		}
+	}
+}
+
+// TestPreySwitching tests that a switching predator keeps its total attack rate while moving it to the abundant prey,
+// and that both integrators use the switched interactions
+func TestPreySwitching(t *testing.T) {
+	scenario := ReadScenario("scenarios/prey_switching.json")
+	ecosystem := BuildEcosystem(scenario)
+
+	// with the prey at 30 and 10 and m = 2, the attack rates are split 9 : 1
+	x := []float64{30, 10, 5}
+	effective := EffectiveInteraction(ecosystem, x)
+	if got := effective.At(0, 2) + effective.At(1, 2); math.Abs(got+0.06) > 1e-12 {
+		t.Errorf("total attack rate %v, want -0.06", got)
+	}
+	if math.Abs(effective.At(0, 2)+0.054) > 1e-12 || math.Abs(effective.At(2, 0)-0.018) > 1e-12 {
+		t.Errorf("attack on and conversion of prey 0 are %v and %v, want -0.054 and 0.018", effective.At(0, 2), effective.At(2, 0))
+	}
+
+	shares := DietComposition(ecosystem, x)
+	if want := 27.0 / 28; len(shares) != 2 || math.Abs(shares[0]-want) > 1e-12 || math.Abs(shares[0]+shares[1]-1) > 1e-12 {
+		t.Errorf("diet shares %v, want %v and %v", shares, want, 1-want)
+	}
+
+	state := InitializeLVState(ecosystem, 0.002)
+	StepLVState(state)
+	updated := UpdatePopulation(ecosystem, 0.002)
+	for i := range x {
+		if math.Abs(state.pop[i]-updated.At(i, 0)) > 1e-12 {
+			t.Errorf("species %d: StepLVState() gives %v, UpdatePopulation() gives %v", i, state.pop[i], updated.At(i, 0))
+		}
+	}
+
+	// the equilibrium zeroes the switched growth rates, and the Jacobian matches finite differences of the vector field
+	equilibrium, ok := InteriorEquilibrium(ecosystem)
+	if !ok || !allPositive(equilibrium) {
+		t.Fatalf("InteriorEquilibrium() = %v, %v, want a feasible equilibrium", equilibrium, ok)
+	}
+	for i, growth := range PerCapitaGrowth(ecosystem, equilibrium) {
+		if math.Abs(growth) > 1e-9 {
+			t.Errorf("growth rate of species %d at the equilibrium is %v, want 0", i, growth)
+		}
+	}
+	jacobian := Jacobian(ecosystem, x)
+	for l := range x {
+		plus := append([]float64(nil), x...)
+		minus := append([]float64(nil), x...)
+		plus[l] += 1e-5
+		minus[l] -= 1e-5
+		fPlus, fMinus := VectorField(ecosystem, plus), VectorField(ecosystem, minus)
+		for i := range x {
+			if want := (fPlus[i] - fMinus[i]) / 2e-5; math.Abs(jacobian.At(i, l)-want) > 1e-6 {
+				t.Errorf("Jacobian element (%d, %d) is %v, want %v", i, l, jacobian.At(i, l), want)
+			}
+		}
+	}
+}
+
+// TestDrawLineChartFrames tests that the line chart animation has one frame every frequency time points plus the last one,
+// and that the phase plane is drawn next to the population curves
+func TestDrawLineChartFrames(t *testing.T) {
+	timePoints := SimulateEcosystemSampled(BuildEcosystem(presets["stable"]), 110, 0.002, 10)
+
+	lines := DrawLineChartFrames(timePoints, 0.02, 5, nil)
+	if len(lines) != 4 {
+		t.Errorf("%d frames for 12 time points every 5, want 4", len(lines))
+	}
+
+	withPhase := DrawLineChartFrames(timePoints, 0.02, 5, []int{0, 1})
+	if got, narrow := withPhase[0].Bounds().Dx(), lines[0].Bounds().Dx(); got <= narrow {
+		t.Errorf("frames with a phase plane are %d pixels wide, want more than the %d of the curves alone", got, narrow)
+	}
+}
+
+// TestWriteGIF tests that the frames rendered in parallel are written in order to a GIF that loops forever,
+// with the exact colors of every frame
+func TestWriteGIF(t *testing.T) {
+	timePoints := SimulateEcosystemSampled(BuildEcosystem(presets["stable"]), 110, 0.002, 10)
+	numFrames, render := LineChartRenderer(timePoints, 0.02, 3, []int{0, 1})
+
+	filename := t.TempDir() + "/lines.gif"
+	WriteGIF(filename, numFrames, render, 3)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(animation.Image) != numFrames || animation.LoopCount != 0 {
+		t.Fatalf("%d frames looping %d times, want %d frames looping forever", len(animation.Image), animation.LoopCount, numFrames)
+	}
+	// the frames have few colors, so the palette holds them exactly and the frames are written in order
+	for k, frame := range animation.Image {
+		want := render(k)
+		if frame.Bounds() != want.Bounds() {
+			t.Fatalf("frame %d has bounds %v, want %v", k, frame.Bounds(), want.Bounds())
+		}
+		for y := 0; y < want.Bounds().Dy(); y += 7 {
+			for x := 0; x < want.Bounds().Dx(); x += 7 {
+				if color.RGBAModel.Convert(frame.At(x, y)) != color.RGBAModel.Convert(want.At(x, y)) {
+					t.Fatalf("frame %d differs from its rendering at (%d, %d)", k, x, y)
+				}
+			}
+		}
+	}
+}
+
+// TestCanvas tests that the Canvas fills circles and strokes lines of the given width on the pixels they cover,
+// and that painting clears the path
+func TestCanvas(t *testing.T) {
+	c := CreateNewCanvas(40, 40)
+	c.SetFillColor(MakeColor(0, 0, 0))
+	c.ClearRect(0, 0, 40, 40)
+
+	red := MakeColor(255, 0, 0)
+	c.SetFillColor(red)
+	c.Circle(20, 20, 10)
+	c.Fill()
+
+	blue := MakeColor(0, 0, 255)
+	c.SetStrokeColor(blue)
+	c.SetLineWidth(3)
+	c.MoveTo(0, 2)
+	c.LineTo(40, 2)
+	c.Stroke()
+
+	img := c.GetImage()
+	tests := []struct {
+		x, y int
+		want color.Color
+	}{
+		{20, 20, red}, {11, 20, red}, {28, 20, red}, {20, 29, red},
+		{8, 20, color.Black}, {27, 27, color.Black}, {35, 35, color.Black},
+		{0, 1, blue}, {39, 3, blue}, {20, 5, color.Black},
+	}
+	for _, test := range tests {
+		if got := color.RGBAModel.Convert(img.At(test.x, test.y)); got != color.RGBAModel.Convert(test.want) {
+			t.Errorf("pixel (%d, %d) is %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	// the path is cleared once painted
+	c.SetFillColor(blue)
+	c.Fill()
+	if got := color.RGBAModel.Convert(img.At(20, 20)); got != color.RGBAModel.Convert(red) {
+		t.Errorf("filling an empty path changed the circle to %v", got)
+	}
+}
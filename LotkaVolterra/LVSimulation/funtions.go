@@ -15,18 +15,15 @@ import (
 // It returns an array of numGens + 1 *Ecosystem pointers timePoints, where timePoints[0] is the initial ecosystem,
 // and timePoints[i] represents the ecosystem object in the i-th time step of the ecosystem simulation starting with initialEcosystem,
 // assuming that in each step of the simulation we use a time value equal to time interval.
+// Ecosystems with delayed interactions are simulated by SimulateDelayEcosystem with a constant history.
+// Every step applies the update of UpdateEcosystem to a preallocated state vector (see LVState),
+// and the time points share the matrices of the initial ecosystem.
 func SimulateEcosystem(initialEcosystem *Ecosystem, numGens int, time float64) []*Ecosystem {
-	// initialize an array of numGens + 1 *Ecosystem pointers
-	timePoints := make([]*Ecosystem, numGens+1)
-	// assign the first element of the array to be the initial ecosystem
-	timePoints[0] = initialEcosystem
-
-	// range over the number of ecosystems and set the i-th ecosystem equal to updating the (i-1)th ecosystem
-	for i := 1; i < numGens+1; i++ {
-		timePoints[i] = UpdateEcosystem(timePoints[i-1], time)
+	if initialEcosystem.delay != nil {
+		return SimulateDelayEcosystem(initialEcosystem, numGens, time, nil)
 	}
 
-	return timePoints
+	return SimulateEcosystemSampled(initialEcosystem, numGens, time, 1)
 }
 
 // UpdateEcosystem() takes a pointer of Ecosystem object, a float64 object time,
@@ -67,10 +64,29 @@ func Copy(ecosystem *Ecosystem) *Ecosystem {
 	// copy the deathGrowth matrix
 	newEcosystem.deathGrowth = DeepCopyMatrix(ecosystem.deathGrowth) // ecosystem.deathGrowth
 
+	// copy the stage transfer matrix, if the ecosystem has stage-structured species
+	if ecosystem.stageTransfer != nil {
+		newEcosystem.stageTransfer = DeepCopyMatrix(ecosystem.stageTransfer)
+	}
+
+	// copy the delay matrix, if the interactions are delayed
+	if ecosystem.delay != nil {
+		newEcosystem.delay = DeepCopyMatrix(ecosystem.delay)
+	}
+
+	newEcosystem.model = ecosystem.model
+	newEcosystem.higherOrder = ecosystem.higherOrder
+	newEcosystem.switching = ecosystem.switching
+
 	return newEcosystem
 }
 
 func DeepCopyMatrix(m mat.Matrix) mat.Matrix {
+	// sparse matrices keep their format
+	if sparse, ok := m.(*SparseMatrix); ok {
+		return ScaleSparse(1, sparse)
+	}
+
 	// Type assert to check if it's a *mat.Dense
 	if md, ok := m.(*mat.Dense); ok {
 		// Use the RawMatrix method to get the underlying data slice
@@ -109,6 +125,11 @@ func CopySpecies(species []*Specie) []*Specie {
 		newSpecies[i] = &Specie{
 			index:      specie.index,
 			population: specie.population,
+			name:       specie.name,
+			color:      specie.color,
+			role:       specie.role,
+			stage:      specie.stage,
+			trait:      specie.trait,
 		}
 	}
 
@@ -125,15 +146,28 @@ func UpdatePopulation(ecosystem *Ecosystem, time float64) mat.Matrix {
 	// calculate F = ∆t · G + 1, return a Matrix
 	f := CalculateF(ecosystem.deathGrowth, time)
 
-	// calculate H = ∆t · D, return a Matirx
-	h := CalculateH(ecosystem.interaction, time)
-
 	p := InitializePop(ecosystem.species)
 
+	// calculate H = ∆t · D, return a Matirx
+	// (D is the interaction matrix switched to the current populations if the predators switch prey)
+	h := CalculateH(EffectiveInteraction(ecosystem, mat.Col(nil, 0, p)), time)
+
+	// the higher-order interactions add ∆t · Σ_jk b_ijk p_j p_k to F
+	if ecosystem.higherOrder != nil {
+		rates := mat.Col(nil, 0, f)
+		AddHigherOrderTerms(ecosystem.higherOrder, mat.Col(nil, 0, p), time, rates)
+		f = mat.NewDense(len(rates), 1, rates)
+	}
+
 	// calculate updated population
 	// newPop = (h*p + f) * p
 	newP = CalculatePop(f, h, p)
 
+	// add the maturation and reproduction flows between the stages of stage-structured species
+	if ecosystem.stageTransfer != nil {
+		newP = AddStageTransfer(newP, ecosystem.stageTransfer, p, time)
+	}
+
 	return newP
 }
 
@@ -195,6 +229,12 @@ func CalculatePop(f, h, p mat.Matrix) mat.Matrix {
 
 // WriteToCSV writes the population of each species for each numGen in the ecosystem to a CSV file
 func WriteToCSV(ecosystems []*Ecosystem, filename string) {
+	WriteSampledCSV(ecosystems, filename, 1)
+}
+
+// WriteSampledCSV() writes time points kept every sampleEvery generations to a CSV file like WriteToCSV,
+// numbering the rows with their generation in the full simulation.
+func WriteSampledCSV(ecosystems []*Ecosystem, filename string, sampleEvery int) {
 	// Create a new csv file
 	file, err := os.Create(filename)
 	if err != nil {
@@ -210,7 +250,7 @@ func WriteToCSV(ecosystems []*Ecosystem, filename string) {
 	// Write the header row
 	header := []string{"Generation"}
 	for _, specie := range ecosystems[0].species {
-		header = append(header, "Species "+strconv.Itoa(specie.index))
+		header = append(header, SpeciesName(specie))
 	}
 
 	if err := writer.Write(header); err != nil {
@@ -220,7 +260,7 @@ func WriteToCSV(ecosystems []*Ecosystem, filename string) {
 
 	// Write the population data for each ecosystem
 	for i, ecosystem := range ecosystems {
-		row := []string{strconv.Itoa(i)}
+		row := []string{strconv.Itoa(i * sampleEvery)}
 		for _, specie := range ecosystem.species {
 			row = append(row, strconv.FormatFloat(specie.population, 'f', -1, 64))
 		}
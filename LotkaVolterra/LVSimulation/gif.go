@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"sort"
+	"sync"
+)
+
+// gifDelay is the time between two frames of the animated GIFs, in hundredths of a second.
+const gifDelay = 1
+
+// FrameRenderer returns frame k of an animation. WriteGIF() calls it from several goroutines at once,
+// so it must only read shared data.
+type FrameRenderer func(k int) image.Image
+
+// Quantizer maps the colors of frames to the indices of a palette, remembering the index of every color it has seen:
+// frames only have a few colors, so this is much faster than looking up the nearest palette color for every pixel.
+// A Quantizer is not safe for concurrent use, so every worker has its own.
+type Quantizer struct {
+	palette color.Palette
+	indices map[color.RGBA]uint8
+}
+
+// RenderFrames() takes a number of frames and their FrameRenderer, and returns all the frames in order.
+func RenderFrames(numFrames int, render FrameRenderer) []image.Image {
+	frames := make([]image.Image, numFrames)
+	for k := range frames {
+		frames[k] = render(k)
+	}
+	return frames
+}
+
+// BuildPalette() takes the first frame of an animation, and returns the palette of the whole animation: the colors of
+// the frame by decreasing frequency, exactly if there are at most 256 of them, otherwise the 128 most frequent ones
+// completed with every other color of the Plan9 palette for the colors of later frames.
+func BuildPalette(img image.Image) color.Palette {
+	counts := make(map[color.RGBA]int)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			counts[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)]++
+		}
+	}
+
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(a, b int) bool {
+		if counts[colors[a]] != counts[colors[b]] {
+			return counts[colors[a]] > counts[colors[b]]
+		}
+		return packRGBA(colors[a]) < packRGBA(colors[b])
+	})
+
+	result := make(color.Palette, 0, 256)
+	if len(colors) <= 256 {
+		for _, c := range colors {
+			result = append(result, c)
+		}
+		return result
+	}
+	for _, c := range colors[:128] {
+		result = append(result, c)
+	}
+	for k := 0; k < len(palette.Plan9); k += 2 {
+		result = append(result, palette.Plan9[k])
+	}
+	return result
+}
+
+// packRGBA() returns the four channels of a color packed in one number, to order colors with the same frequency.
+func packRGBA(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+// NewQuantizer() takes a palette, and returns a Quantizer to it.
+func NewQuantizer(p color.Palette) *Quantizer {
+	return &Quantizer{palette: p, indices: make(map[color.RGBA]uint8)}
+}
+
+// Quantize() takes a Quantizer and a frame, and returns the frame with the Quantizer's palette,
+// every color replaced by the nearest color of the palette.
+func Quantize(quantizer *Quantizer, img image.Image) *image.Paletted {
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+
+	bounds := rgba.Bounds()
+	paletted := image.NewPaletted(bounds, quantizer.palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		source := rgba.Pix[rgba.PixOffset(bounds.Min.X, y):]
+		target := paletted.Pix[paletted.PixOffset(bounds.Min.X, y):]
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.RGBA{R: source[4*x], G: source[4*x+1], B: source[4*x+2], A: source[4*x+3]}
+			index, seen := quantizer.indices[c]
+			if !seen {
+				index = uint8(quantizer.palette.Index(c))
+				quantizer.indices[c] = index
+			}
+			target[x] = index
+		}
+	}
+
+	return paletted
+}
+
+// EncodeGIFFrame() takes a frame with the palette of its animation, and returns its encoding split in two:
+// the GIF header with the palette as global color table, and the blocks of the frame itself (its delay and
+// compressed pixels). The blocks of frames with the same palette and size can follow one header in any number.
+func EncodeGIFFrame(frame *image.Paletted) ([]byte, []byte) {
+	var buffer bytes.Buffer
+	animation := &gif.GIF{
+		Image:  []*image.Paletted{frame},
+		Delay:  []int{gifDelay},
+		Config: image.Config{ColorModel: frame.Palette, Width: frame.Bounds().Dx(), Height: frame.Bounds().Dy()},
+	}
+	if err := gif.EncodeAll(&buffer, animation); err != nil {
+		panic("Error: encoding a GIF frame failed: " + err.Error())
+	}
+
+	// the header is the signature, the logical screen descriptor and the global color table, and the last byte the trailer
+	data := buffer.Bytes()
+	headerLength := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		headerLength += 3 << (flags&0x07 + 1)
+	}
+	return data[:headerLength], data[headerLength : len(data)-1]
+}
+
+// WriteGIF() takes the name of a GIF file, a number of frames, their FrameRenderer and a number of workers.
+// The workers render, quantize and compress the frames concurrently, while the frames are written to the file
+// in order as soon as they are ready, so that at most 2*workers frames are held in memory at once.
+// The palette is built once, from the first frame, and the animation loops forever.
+func WriteGIF(filename string, numFrames int, render FrameRenderer, workers int) {
+	if numFrames == 0 {
+		return
+	}
+	workers = max(1, workers)
+
+	first := render(0)
+	gifPalette := BuildPalette(first)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	type encodedFrame struct {
+		k      int
+		header []byte
+		blocks []byte
+	}
+
+	// the window holds one token per frame in flight, and a token is given back when its frame is written
+	jobs := make(chan int)
+	results := make(chan encodedFrame)
+	window := make(chan struct{}, 2*workers)
+	go func() {
+		for k := 0; k < numFrames; k++ {
+			window <- struct{}{}
+			jobs <- k
+		}
+		close(jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			quantizer := NewQuantizer(gifPalette)
+			for k := range jobs {
+				img := first
+				if k > 0 {
+					img = render(k)
+				}
+				header, blocks := EncodeGIFFrame(Quantize(quantizer, img))
+				results <- encodedFrame{k: k, header: header, blocks: blocks}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// frames that are ready before the ones preceding them wait in pending
+	pending := make(map[int]encodedFrame)
+	next := 0
+	for result := range results {
+		pending[result.k] = result
+		for frame, ok := pending[next]; ok; frame, ok = pending[next] {
+			if next == 0 {
+				writer.Write(frame.header)
+				// the NETSCAPE2.0 application extension makes the animation loop forever
+				writer.Write([]byte{0x21, 0xFF, 0x0B})
+				writer.WriteString("NETSCAPE2.0")
+				writer.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+			}
+			writer.Write(frame.blocks)
+			delete(pending, next)
+			next++
+			<-window
+		}
+	}
+	writer.WriteByte(0x3B)
+
+	// the writer keeps its first error, so it is only checked once
+	if err := writer.Flush(); err != nil {
+		fmt.Println("Error writing GIF:", err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// HigherOrderEntry is one nonzero coefficient b_ijk of a third-order interaction tensor: the effect of the pair
+// of species j and k on the per-capita growth rate of species i, e.g. species k changing how strongly predator j eats prey i.
+type HigherOrderEntry struct {
+	I     int     `json:"i"`
+	J     int     `json:"j"`
+	K     int     `json:"k"`
+	Value float64 `json:"value"`
+}
+
+// HigherOrderTensor is a sparse third-order interaction tensor, which adds Σ_jk b_ijk x_j x_k to the per-capita
+// growth rate of every species i. It is never modified once built, so copies of an ecosystem share it.
+type HigherOrderTensor struct {
+	byTarget [][]HigherOrderEntry // the entries of every species i
+}
+
+// NewHigherOrderTensor() takes the number of species and the nonzero entries of a third-order interaction tensor,
+// and returns the HigherOrderTensor holding them.
+func NewHigherOrderTensor(numSpecies int, entries []HigherOrderEntry) *HigherOrderTensor {
+	tensor := &HigherOrderTensor{byTarget: make([][]HigherOrderEntry, numSpecies)}
+	for _, entry := range entries {
+		if entry.I < 0 || entry.I >= numSpecies || entry.J < 0 || entry.J >= numSpecies || entry.K < 0 || entry.K >= numSpecies {
+			panic("Error: higher-order interaction entry out of range.")
+		}
+		tensor.byTarget[entry.I] = append(tensor.byTarget[entry.I], entry)
+	}
+	return tensor
+}
+
+// HigherOrderTerm() takes a HigherOrderTensor, a species index and a slice of populations,
+// and returns the higher-order part Σ_jk b_ijk x_j x_k of the per-capita growth rate of species i.
+func HigherOrderTerm(tensor *HigherOrderTensor, i int, x []float64) float64 {
+	term := 0.0
+	for _, entry := range tensor.byTarget[i] {
+		term += entry.Value * x[entry.J] * x[entry.K]
+	}
+	return term
+}
+
+// AddHigherOrderTerms() takes a HigherOrderTensor, a slice of populations and a scale,
+// and adds scale times the higher-order term of every species i to rates[i].
+func AddHigherOrderTerms(tensor *HigherOrderTensor, x []float64, scale float64, rates []float64) {
+	for i := range tensor.byTarget {
+		rates[i] += scale * HigherOrderTerm(tensor, i, x)
+	}
+}
+
+// AddHigherOrderGradient() takes a HigherOrderTensor and a slice of populations, and adds the derivatives of the
+// higher-order terms to a matrix: ∂/∂x_l of Σ_jk b_ijk x_j x_k is Σ_k (b_ilk + b_ikl) x_k, added to element (i, l)
+// scaled by weights[i] (nil for weights of 1).
+func AddHigherOrderGradient(tensor *HigherOrderTensor, x, weights []float64, m *mat.Dense) {
+	for i, entries := range tensor.byTarget {
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		for _, entry := range entries {
+			m.Set(i, entry.J, m.At(i, entry.J)+weight*entry.Value*x[entry.K])
+			m.Set(i, entry.K, m.At(i, entry.K)+weight*entry.Value*x[entry.J])
+		}
+	}
+}
+
+// PerCapitaGrowth() takes a pointer of Ecosystem object and a slice of populations,
+// and returns the per-capita growth rates r_i + Σ_j a_ij x_j + Σ_jk b_ijk x_j x_k, with the switched interactions
+// of EffectiveInteraction() if the predators switch prey.
+func PerCapitaGrowth(ecosystem *Ecosystem, x []float64) []float64 {
+	n := len(x)
+	interaction := EffectiveInteraction(ecosystem, x)
+	growth := make([]float64, n)
+	for i := 0; i < n; i++ {
+		growth[i] = ecosystem.deathGrowth.At(i, 0)
+		for j := 0; j < n; j++ {
+			growth[i] += interaction.At(i, j) * x[j]
+		}
+	}
+	if ecosystem.higherOrder != nil {
+		AddHigherOrderTerms(ecosystem.higherOrder, x, 1, growth)
+	}
+	return growth
+}
+
+// GrowthGradient() takes a pointer of Ecosystem object and a slice of populations, and returns the matrix G of the
+// derivatives of the per-capita growth rates at those populations: G_il is a_il, plus the gradient of the higher-order
+// terms and the derivatives of the switched attack rates if the ecosystem has them.
+func GrowthGradient(ecosystem *Ecosystem, x []float64) *mat.Dense {
+	gradient := mat.DenseCopyOf(EffectiveInteraction(ecosystem, x))
+	if ecosystem.higherOrder != nil {
+		AddHigherOrderGradient(ecosystem.higherOrder, x, nil, gradient)
+	}
+	if ecosystem.switching != nil {
+		AddSwitchingGradient(ecosystem.switching, ecosystem.interaction, x, nil, gradient)
+	}
+	return gradient
+}
+
+// NonlinearEquilibrium() takes a pointer of Ecosystem object with higher-order interactions or prey switching, and returns
+// its interior equilibrium, where every per-capita growth rate is zero. The growth rates are nonlinear in the populations,
+// so the equilibrium is found by Newton's method, starting from the equilibrium of the pairwise interactions alone,
+// from the initial populations, and from populations of 1. Feasible equilibria are preferred over infeasible ones.
+// The second return value is false if Newton's method converges from none of the starting points.
+func NonlinearEquilibrium(ecosystem *Ecosystem) ([]float64, bool) {
+	n := len(ecosystem.species)
+
+	guesses := make([][]float64, 0, 3)
+	pairwise := &Ecosystem{species: ecosystem.species, interaction: ecosystem.interaction, deathGrowth: ecosystem.deathGrowth}
+	if x, ok := InteriorEquilibrium(pairwise); ok {
+		guesses = append(guesses, x)
+	}
+	initial := make([]float64, n)
+	ones := make([]float64, n)
+	for _, specie := range ecosystem.species {
+		initial[specie.index] = specie.population
+		ones[specie.index] = 1
+	}
+	guesses = append(guesses, initial, ones)
+
+	var found []float64
+	for _, guess := range guesses {
+		x, ok := GrowthRoot(ecosystem, guess)
+		if !ok {
+			continue
+		}
+		if allPositive(x) {
+			return x, true
+		}
+		if found == nil {
+			found = x
+		}
+	}
+
+	return found, found != nil
+}
+
+// GrowthRoot() takes a pointer of Ecosystem object and a guess of its interior equilibrium,
+// and returns the populations at which every per-capita growth rate is zero, found from the guess by Newton's method.
+func GrowthRoot(ecosystem *Ecosystem, guess []float64) ([]float64, bool) {
+	n := len(guess)
+	x := append([]float64(nil), guess...)
+
+	for iteration := 0; iteration < 100; iteration++ {
+		growth := PerCapitaGrowth(ecosystem, x)
+		rhs := mat.NewVecDense(n, nil)
+		for i := range growth {
+			rhs.SetVec(i, -growth[i])
+		}
+
+		gradient := GrowthGradient(ecosystem, x)
+
+		var delta mat.VecDense
+		if err := delta.SolveVec(gradient, rhs); err != nil {
+			return x, false
+		}
+		for i := range x {
+			x[i] += delta.AtVec(i)
+		}
+		if math.IsNaN(floats.Sum(x)) || math.IsInf(floats.Sum(x), 0) {
+			return x, false
+		}
+		if mat.Norm(&delta, 2) < 1e-12*(1+floats.Norm(x, 2)) {
+			return x, true
+		}
+	}
+
+	return x, false
+}
+
+// allPositive() returns true if every value of a slice is positive.
+func allPositive(x []float64) bool {
+	for _, value := range x {
+		if value <= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TimeSeries holds observed abundances: one row per time point and one column per species.
+type TimeSeries struct {
+	names []string
+	times []float64
+	data  [][]float64
+}
+
+// InferredCoefficient holds one estimated gLV parameter with its bootstrap uncertainty.
+type InferredCoefficient struct {
+	species   int
+	parameter int // -1 for the growth rate, otherwise the index j of the interaction a_ij
+	estimate  float64
+	stdErr    float64
+	ciLow     float64 // 2.5% bootstrap percentile
+	ciHigh    float64 // 97.5% bootstrap percentile
+}
+
+// InferenceSettings holds the settings of the regression used to infer a gLV model.
+type InferenceSettings struct {
+	alpha        float64 // elastic net mixing parameter: 0 is ridge, 1 is the lasso
+	numFolds     int
+	numLambdas   int
+	numBootstrap int
+}
+
+// ReadTimeSeriesCSV() takes the name of a CSV file whose first column is the time and whose other columns are
+// species abundances, with a header row naming them (lines starting with # are ignored), and returns its TimeSeries.
+// The first column is multiplied by timeScale, e.g. to turn generation numbers into times.
+func ReadTimeSeriesCSV(filename string, timeScale float64) TimeSeries {
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	if len(records) < 3 {
+		panic("Error: time series " + filename + " needs a header and at least two rows.")
+	}
+
+	series := TimeSeries{}
+	for _, name := range records[0][1:] {
+		series.names = append(series.names, strings.TrimSpace(name))
+	}
+
+	for _, record := range records[1:] {
+		row := make([]float64, len(record))
+		for i, field := range record {
+			row[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				panic(err)
+			}
+		}
+		series.times = append(series.times, row[0]*timeScale)
+		series.data = append(series.data, row[1:])
+	}
+
+	return series
+}
+
+// GLVRegressionData() takes one or more time series of the same species, and returns the design matrix and the responses
+// of the gLV regression: for every pair of consecutive time points with positive abundances,
+// (ln x_i(t + ∆t) - ln x_i(t)) / ∆t = r_i + Σ_j a_ij x_j(t). Row k of the returned responses holds the values for every species.
+func GLVRegressionData(allSeries []TimeSeries) ([][]float64, [][]float64) {
+	X := make([][]float64, 0)
+	Y := make([][]float64, 0)
+
+	for _, series := range allSeries {
+		for t := 0; t+1 < len(series.times); t++ {
+			deltaTime := series.times[t+1] - series.times[t]
+			if deltaTime <= 0 {
+				panic("Error: times in a time series must be increasing.")
+			}
+
+			// log-differences are only defined for positive abundances
+			positive := true
+			for i := range series.names {
+				if series.data[t][i] <= 0 || series.data[t+1][i] <= 0 {
+					positive = false
+				}
+			}
+			if !positive {
+				continue
+			}
+
+			y := make([]float64, len(series.names))
+			for i := range y {
+				y[i] = (math.Log(series.data[t+1][i]) - math.Log(series.data[t][i])) / deltaTime
+			}
+
+			X = append(X, series.data[t])
+			Y = append(Y, y)
+		}
+	}
+
+	return X, Y
+}
+
+// InferGLV() takes one or more time series of the same species and the regression settings.
+// For every species it chooses the penalty by cross-validation, fits the growth rate and interactions by elastic net regression,
+// and estimates their uncertainty by bootstrap. It returns the growth vector, the interaction matrix, and every coefficient.
+func InferGLV(allSeries []TimeSeries, settings InferenceSettings) ([]float64, mat.Matrix, []InferredCoefficient) {
+	X, Y := GLVRegressionData(allSeries)
+	numSpecies := len(allSeries[0].names)
+	if len(X) < settings.numFolds || len(X) <= numSpecies {
+		panic("Error: not enough time points with positive abundances to infer the model.")
+	}
+
+	growth := make([]float64, numSpecies)
+	interaction := mat.NewDense(numSpecies, numSpecies, nil)
+	coefficients := make([]InferredCoefficient, 0)
+
+	for i := 0; i < numSpecies; i++ {
+		y := make([]float64, len(Y))
+		for k := range Y {
+			y[k] = Y[k][i]
+		}
+
+		lambdas := LambdaGrid(X, y, settings.alpha, settings.numLambdas)
+		lambda := CrossValidateLambda(X, y, settings.alpha, lambdas, settings.numFolds)
+		fit := FitElasticNet(X, y, lambda, settings.alpha)
+		fmt.Printf("%s: penalty %.4g chosen by %d-fold cross-validation\n", allSeries[0].names[i], lambda, settings.numFolds)
+
+		growth[i] = fit.intercept
+		for j := 0; j < numSpecies; j++ {
+			interaction.Set(i, j, fit.coef[j])
+		}
+
+		// collect the bootstrap estimates of every coefficient of species i, the growth rate first
+		samples := make([][]float64, numSpecies+1)
+		for _, sample := range BootstrapElasticNet(X, y, lambda, settings.alpha, settings.numBootstrap) {
+			samples[0] = append(samples[0], sample.intercept)
+			for j, c := range sample.coef {
+				samples[j+1] = append(samples[j+1], c)
+			}
+		}
+
+		estimates := append([]float64{fit.intercept}, fit.coef...)
+		for j, estimate := range estimates {
+			coefficient := InferredCoefficient{species: i, parameter: j - 1, estimate: estimate}
+			coefficient.stdErr, coefficient.ciLow, coefficient.ciHigh = BootstrapInterval(samples[j])
+			coefficients = append(coefficients, coefficient)
+		}
+	}
+
+	return growth, interaction, coefficients
+}
+
+// BootstrapInterval() takes the bootstrap estimates of a coefficient, and returns their standard deviation
+// and the 2.5% and 97.5% percentiles. It returns NaNs if there are no estimates.
+func BootstrapInterval(samples []float64) (float64, float64, float64) {
+	if len(samples) == 0 {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	mean := 0.0
+	for _, v := range sorted {
+		mean += v
+	}
+	mean /= float64(len(sorted))
+
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	if len(sorted) > 1 {
+		variance /= float64(len(sorted) - 1)
+	}
+
+	low := sorted[int(0.025*float64(len(sorted)-1))]
+	high := sorted[int(math.Ceil(0.975*float64(len(sorted)-1)))]
+
+	return math.Sqrt(variance), low, high
+}
+
+// WriteCoefficientsCSV writes the inferred coefficients with their uncertainty to a CSV file.
+func WriteCoefficientsCSV(coefficients []InferredCoefficient, names []string, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Species", "Parameter", "Estimate", "StdErr", "CILow", "CIHigh"}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+	for _, c := range coefficients {
+		parameter := "growth"
+		if c.parameter >= 0 {
+			parameter = "interaction " + names[c.parameter]
+		}
+
+		row := []string{names[c.species], parameter}
+		for _, v := range []float64{c.estimate, c.stdErr, c.ciLow, c.ciHigh} {
+			row = append(row, strconv.FormatFloat(v, 'g', 6, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// InferredScenario() takes the first observed time series and the inferred parameters, and returns a Scenario that
+// starts from the first observation and runs until the last one, with a time interval of at most 0.002 that divides
+// the shortest observation interval. Unevenly sampled series are supported, as the run covers their whole time span.
+func InferredScenario(series TimeSeries, growth []float64, interaction mat.Matrix, name string) Scenario {
+	if len(series.times) < 2 {
+		panic("Error: a time series needs at least two observations to build a scenario.")
+	}
+
+	numSpecies := len(series.names)
+	duration := series.times[len(series.times)-1] - series.times[0]
+	deltaTime := math.Inf(1)
+	for t := 1; t < len(series.times); t++ {
+		deltaTime = math.Min(deltaTime, series.times[t]-series.times[t-1])
+	}
+	if deltaTime <= 0 {
+		panic("Error: times in a time series must be increasing.")
+	}
+
+	substeps := math.Ceil(deltaTime / 0.002)
+	scenario := Scenario{
+		Name:        name,
+		Time:        deltaTime / substeps,
+		NumGens:     int(math.Ceil(duration / deltaTime * substeps)),
+		Species:     make([]ScenarioSpecies, numSpecies),
+		Interaction: make([][]float64, numSpecies),
+	}
+
+	for i := 0; i < numSpecies; i++ {
+		scenario.Species[i] = ScenarioSpecies{
+			Name:       series.names[i],
+			Population: series.data[0][i],
+			Growth:     growth[i],
+		}
+		scenario.Interaction[i] = mat.Row(nil, i, interaction)
+	}
+
+	return scenario
+}
+
+// ReplayError() takes an observed time series and the time points simulated from its inferred scenario,
+// and returns the root mean squared error of every species at the observed times.
+func ReplayError(series TimeSeries, timePoints []*Ecosystem, time float64) []float64 {
+	rmse := make([]float64, len(series.names))
+	count := 0
+
+	for t, observedTime := range series.times {
+		step := int(math.Round((observedTime - series.times[0]) / time))
+		if step >= len(timePoints) {
+			break
+		}
+		for i := range series.names {
+			e := timePoints[step].species[i].population - series.data[t][i]
+			rmse[i] += e * e
+		}
+		count++
+	}
+
+	for i := range rmse {
+		rmse[i] = math.Sqrt(rmse[i] / float64(count))
+	}
+
+	return rmse
+}
+
+// InferCommand infers a gLV model from one or more observed time series CSV files.
+// It writes the coefficients to ./output/<name>_coefficients.csv and a replayable scenario to ./output/<name>_scenario.json,
+// and replays the scenario against the first time series.
+func InferCommand(args []string) {
+	flags := flag.NewFlagSet("infer", flag.ExitOnError)
+	timeScale := flags.Float64("timescale", 1, "multiplier turning the first column into times (e.g. 0.002 for Generation)")
+	alpha := flags.Float64("alpha", 0, "elastic net mixing parameter: 0 is ridge regression, 1 is the lasso")
+	numFolds := flags.Int("folds", 5, "number of cross-validation folds")
+	numLambdas := flags.Int("lambdas", 20, "number of penalties tried by cross-validation")
+	numBootstrap := flags.Int("bootstrap", 200, "number of bootstrap samples")
+	name := flags.String("name", "inferred", "name of the output files")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		panic("Error: the infer command takes one or more time series CSV files.")
+	}
+	if *alpha < 0 || *alpha > 1 {
+		panic("Error: alpha must be between 0 and 1.")
+	}
+	if *numLambdas < 2 {
+		panic("Error: cross-validation needs at least 2 penalties.")
+	}
+
+	allSeries := make([]TimeSeries, flags.NArg())
+	for k, filename := range flags.Args() {
+		allSeries[k] = ReadTimeSeriesCSV(filename, *timeScale)
+		if strings.Join(allSeries[k].names, ",") != strings.Join(allSeries[0].names, ",") {
+			panic("Error: every time series must have the same species columns.")
+		}
+	}
+	fmt.Println("Read", len(allSeries), "time series of species", allSeries[0].names)
+
+	settings := InferenceSettings{alpha: *alpha, numFolds: *numFolds, numLambdas: *numLambdas, numBootstrap: *numBootstrap}
+	growth, interaction, coefficients := InferGLV(allSeries, settings)
+
+	WriteCoefficientsCSV(coefficients, allSeries[0].names, "./output/"+*name+"_coefficients.csv")
+
+	scenario := InferredScenario(allSeries[0], growth, interaction, *name)
+	WriteScenario(scenario, "./output/"+*name+"_scenario.json")
+	fmt.Println("Coefficients and scenario written to ./output/" + *name + "_coefficients.csv and _scenario.json")
+
+	// print the estimates with their bootstrap intervals
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Species\tParameter\tEstimate\t95% CI")
+	for _, c := range coefficients {
+		parameter := "r"
+		if c.parameter >= 0 {
+			parameter = "a[" + allSeries[0].names[c.parameter] + "]"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%.4g\t[%.4g, %.4g]\n", allSeries[0].names[c.species], parameter, c.estimate, c.ciLow, c.ciHigh)
+	}
+	writer.Flush()
+
+	// replay the inferred scenario against the first time series
+	timePoints := SimulateEcosystem(BuildEcosystem(scenario), scenario.NumGens, scenario.Time)
+	rmse := ReplayError(allSeries[0], timePoints, scenario.Time)
+	for i, e := range rmse {
+		fmt.Printf("Replay RMSE of %s: %.4g\n", allSeries[0].names[i], e)
+	}
+}
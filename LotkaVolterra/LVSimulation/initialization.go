@@ -2,6 +2,7 @@ package main
 
 import (
 	"math/rand"
+	"strconv"
 	"time"
 
 	"gonum.org/v1/gonum/mat"
@@ -11,7 +12,8 @@ import (
 // data from user input: numSpecies int; growthRate float64 – for grass, the only prey in the ecosystem; deathRate []float64 – for all other species.
 // It initializes the ecosystem object with a certain number of species, and returns an Ecosystem object.
 // interaction matrix and deathGrowth matrix are generated by two help functions.
-func InitializeEcosystem(numSpecies int, pop []float64, interaction mat.Matrix, deathGrowth mat.Matrix) *Ecosystem {
+// metadata gives the name, color and role of each species; it may be nil, or have empty fields, to use the defaults.
+func InitializeEcosystem(numSpecies int, pop []float64, metadata []SpeciesMetadata, interaction mat.Matrix, deathGrowth mat.Matrix) *Ecosystem {
 	// // Method 1 - some nil pointers problems
 	// // initialize an Ecosystem object and a species slice
 	// ecosystem := &Ecosystem{}
@@ -48,15 +50,57 @@ func InitializeEcosystem(numSpecies int, pop []float64, interaction mat.Matrix,
 
 	// initialize ecosystem for i species
 	for i := 0; i < numSpecies; i++ {
+		info := DefaultMetadata(i, metadata, deathGrowth)
 		ecosystem.species[i] = &Specie{
 			population: pop[i],
 			index:      i,
+			name:       info.name,
+			color:      info.color,
+			role:       info.role,
+			stage:      info.stage,
 		}
 	}
 
 	return ecosystem
 }
 
+// DefaultMetadata() takes a species index, the metadata given by the user (possibly nil) and the deathGrowth matrix.
+// It returns the metadata of that species with missing fields filled in: the name defaults to "Species i",
+// and the role defaults to "producer" for a positive growth rate and "consumer" otherwise.
+func DefaultMetadata(index int, metadata []SpeciesMetadata, deathGrowth mat.Matrix) SpeciesMetadata {
+	info := SpeciesMetadata{}
+	if index < len(metadata) {
+		info = metadata[index]
+	}
+
+	if info.name == "" {
+		info.name = "Species " + strconv.Itoa(index)
+	}
+
+	if info.role == "" {
+		if deathGrowth.At(index, 0) > 0 {
+			info.role = "producer"
+		} else {
+			info.role = "consumer"
+		}
+	}
+
+	return info
+}
+
+// SpeciesName() returns the name of a species, or "Species i" if it has none.
+// The stage of a stage-structured species is added in brackets, e.g. "Hare (juvenile)".
+func SpeciesName(specie *Specie) string {
+	name := specie.name
+	if name == "" {
+		name = "Species " + strconv.Itoa(specie.index)
+	}
+	if specie.stage != "" {
+		name += " (" + specie.stage + ")"
+	}
+	return name
+}
+
 func InitializePop(species []*Specie) mat.Matrix {
 	// get the length of the species slice
 	numSpecies := len(species)
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// KeystoneSettings holds the parameters of a keystone analysis.
+type KeystoneSettings struct {
+	threshold  float64 // population below which a species counts as extinct
+	workers    int     // number of removals simulated in parallel
+	simulation SimulationSettings
+}
+
+// RemovalResult is the outcome of removing one species from a community and simulating it again.
+type RemovalResult struct {
+	removed       int   // index of the removed species, or -1 for the control run without removal
+	secondary     []int // species that survive in the control run but go extinct after the removal
+	biomass       float64
+	biomassChange float64 // change of the total biomass relative to the control run; NaN if undefined
+	stability     float64 // largest real part of the eigenvalues of the survivors' Jacobian at the end
+	dynamics      string  // "equilibrium", "cycle" or "diverged"
+	survivors     []int
+}
+
+// CommunityStability() takes a pointer of Ecosystem object, the populations of every species and the surviving species,
+// and returns the largest real part of the eigenvalues of the Jacobian restricted to the survivors:
+// negative values mean that the community returns to the state after small perturbations.
+func CommunityStability(ecosystem *Ecosystem, x []float64, survivors []int) float64 {
+	if len(survivors) == 0 {
+		return math.NaN()
+	}
+
+	jacobian := Jacobian(ecosystem, x)
+	restricted := mat.NewDense(len(survivors), len(survivors), nil)
+	for a, i := range survivors {
+		for b, j := range survivors {
+			restricted.Set(a, b, jacobian.At(i, j))
+		}
+	}
+
+	return MaxRealPart(Eigenvalues(restricted))
+}
+
+// SimulateRemoval() takes the state of a community, the index of the species to remove (-1 for none) and keystone settings.
+// It sets the population of the removed species to 0, simulates the community, and returns the RemovalResult
+// without the comparison to the control run.
+func SimulateRemoval(state *Ecosystem, removed int, settings KeystoneSettings) RemovalResult {
+	ecosystem := Copy(state)
+	if removed >= 0 {
+		ecosystem.species[removed].population = 0
+	}
+
+	timePoints := SimulateWithSettings(ecosystem, settings.simulation)
+	finalState := ClassifyFinalState(timePoints, settings.threshold)
+	result := RemovalResult{removed: removed, dynamics: finalState.dynamics, survivors: finalState.survivors}
+
+	last := timePoints[len(timePoints)-1]
+	x := make([]float64, len(last.species))
+	for _, specie := range last.species {
+		x[specie.index] = specie.population
+		if specie.population > settings.threshold {
+			result.biomass += specie.population
+		}
+	}
+	if result.dynamics != "diverged" {
+		result.stability = CommunityStability(last, x, result.survivors)
+	} else {
+		result.biomass, result.stability = math.NaN(), math.NaN()
+	}
+
+	return result
+}
+
+// KeystoneAnalysis() takes the initial *Ecosystem object and keystone settings. It simulates the ecosystem to reach
+// the state of the community, and from this same state simulates a control run and the removal of every species
+// that has not died out, in parallel. It returns the control run and the removals, ranked by their impact with RankRemovals().
+func KeystoneAnalysis(initialEcosystem *Ecosystem, settings KeystoneSettings) (RemovalResult, []RemovalResult) {
+	timePoints := SimulateWithSettings(initialEcosystem, settings.simulation)
+	state := timePoints[len(timePoints)-1]
+
+	// the runs start from the state, so they have no history before it
+	settings.simulation.history = nil
+
+	control := SimulateRemoval(state, -1, settings)
+
+	present := make([]int, 0, len(state.species))
+	for _, specie := range state.species {
+		if specie.population > 0 {
+			present = append(present, specie.index)
+		}
+	}
+
+	results := make([]RemovalResult, len(present))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < settings.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				// every job writes its own element, so no lock is needed
+				results[k] = SimulateRemoval(state, present[k], settings)
+			}
+		}()
+	}
+	for k := range present {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+
+	// compare every removal with the control run
+	for k := range results {
+		surviving := make(map[int]bool)
+		for _, i := range results[k].survivors {
+			surviving[i] = true
+		}
+		for _, i := range control.survivors {
+			if i != results[k].removed && !surviving[i] {
+				results[k].secondary = append(results[k].secondary, i)
+			}
+		}
+		// the change is undefined if either run diverged or nothing survives the control run
+		results[k].biomassChange = math.NaN()
+		if control.biomass > 0 {
+			results[k].biomassChange = (results[k].biomass - control.biomass) / control.biomass
+		}
+	}
+
+	RankRemovals(results)
+	return control, results
+}
+
+// RankRemovals() sorts removals by decreasing impact: first by the number of secondary extinctions,
+// then by the size of the change in total biomass. Removals with an undefined biomass change come after the others
+// with as many secondary extinctions.
+func RankRemovals(results []RemovalResult) {
+	sort.SliceStable(results, func(a, b int) bool {
+		if len(results[a].secondary) != len(results[b].secondary) {
+			return len(results[a].secondary) > len(results[b].secondary)
+		}
+		undefinedA, undefinedB := math.IsNaN(results[a].biomassChange), math.IsNaN(results[b].biomassChange)
+		if undefinedA || undefinedB {
+			return !undefinedA && undefinedB
+		}
+		return math.Abs(results[a].biomassChange) > math.Abs(results[b].biomassChange)
+	})
+}
+
+// secondaryNames() returns the names of the secondary extinctions of a removal, or "-" if there are none.
+func secondaryNames(result RemovalResult, species []*Specie) string {
+	if len(result.secondary) == 0 {
+		return "-"
+	}
+	names := ""
+	for k, i := range result.secondary {
+		if k > 0 {
+			names += ", "
+		}
+		names += SpeciesName(species[i])
+	}
+	return names
+}
+
+// PrintKeystoneTable() prints the control run and the ranked removals of a keystone analysis.
+func PrintKeystoneTable(control RemovalResult, results []RemovalResult, species []*Specie) {
+	fmt.Printf("Control: %d species survive, total biomass %.4g, max Re(λ) %.3g, %s\n",
+		len(control.survivors), control.biomass, control.stability, control.dynamics)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Rank\tRemoved\tSecondary extinctions\tBiomass change\tMax Re(λ)\tDynamics")
+	for k, result := range results {
+		change := "undefined"
+		if !math.IsNaN(result.biomassChange) {
+			change = fmt.Sprintf("%+.1f%%", 100*result.biomassChange)
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%.3g\t%s\n", k+1, SpeciesName(species[result.removed]),
+			secondaryNames(result, species), change, result.stability, result.dynamics)
+	}
+	writer.Flush()
+}
+
+// WriteKeystoneCSV() writes the ranked removals of a keystone analysis to a CSV file.
+func WriteKeystoneCSV(results []RemovalResult, species []*Specie, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Rank", "Removed", "Secondary extinctions", "Extinct species", "Total biomass", "Biomass change", "Max real eigenvalue", "Dynamics"}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, result := range results {
+		// an undefined biomass change is left empty
+		change := ""
+		if !math.IsNaN(result.biomassChange) {
+			change = strconv.FormatFloat(result.biomassChange, 'f', -1, 64)
+		}
+		row := []string{
+			strconv.Itoa(k + 1),
+			SpeciesName(species[result.removed]),
+			strconv.Itoa(len(result.secondary)),
+			secondaryNames(result, species),
+			strconv.FormatFloat(result.biomass, 'f', -1, 64),
+			change,
+			strconv.FormatFloat(result.stability, 'f', -1, 64),
+			result.dynamics,
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// DrawKeystone() takes the ranked removals of a keystone analysis, and returns a bar chart of the change in total biomass
+// after every removal in rank order, red for removals causing secondary extinctions, and no bar where the change is undefined. With few species,
+// the index of the removed species is written next to its bar.
+func DrawKeystone(results []RemovalResult) *Plot {
+	low, high := 0.0, 0.0
+	for _, result := range results {
+		if !math.IsNaN(result.biomassChange) {
+			low, high = math.Min(low, 100*result.biomassChange), math.Max(high, 100*result.biomassChange)
+		}
+	}
+	if high-low == 0 {
+		high = 1
+	}
+	padding := 0.05 * (high - low)
+
+	plot := NewPlot(600, 300, 0, float64(len(results)), low-padding, high+padding, 2)
+	PlotLine(plot, 0, 0, float64(len(results)), 0, color.Gray{Y: 120})
+	for k, result := range results {
+		barColor := CategoryColor(0)
+		if len(result.secondary) > 0 {
+			barColor = CategoryColor(3)
+		}
+		if !math.IsNaN(result.biomassChange) {
+			PlotRect(plot, float64(k)+0.15, 0, float64(k)+0.85, 100*result.biomassChange, barColor)
+		}
+
+		// the label goes on the other side of the zero line than the bar
+		if len(results) <= 30 {
+			label := strconv.Itoa(result.removed)
+			x, y := PlotPosition(plot, float64(k)+0.5, 0)
+			if result.biomassChange >= 0 {
+				y += 4
+			} else {
+				y -= 4 + glyphHeight
+			}
+			DrawText(plot.img, x-TextWidth(label, 1)/2, y, label, color.Black, 1)
+		}
+	}
+	DrawAxes(plot, "Species removals", "Removed species by rank", "Biomass change (%)")
+	DrawPlotLegend(plot, []string{"Secondary extinctions", "No secondary extinction"}, []color.Color{CategoryColor(3), CategoryColor(0)})
+
+	return plot
+}
+
+// KeystoneCommand removes every species of a scenario file or preset in turn from the state it reaches, simulates
+// the rest of the community again, and ranks the species by the secondary extinctions and change of total biomass
+// their removal causes. The ranking is printed and written to ./output/<name>_keystone.csv and ./output/<name>_keystone.png.
+func KeystoneCommand(args []string) {
+	flags := flag.NewFlagSet("keystone", flag.ExitOnError)
+	numGens := flags.Int("gens", 0, "number of generations before and after the removals (default the scenario's)")
+	threshold := flags.Float64("threshold", 1e-4, "population below which a species counts as extinct")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of removals simulated in parallel")
+	name := flags.String("name", "", "name of the output files (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the keystone command takes the name of a scenario file or preset.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	ecosystem := BuildEcosystem(scenario)
+	RequireContinuous(ecosystem, "keystone")
+	settings := KeystoneSettings{threshold: *threshold, workers: max(1, *workers), simulation: ScenarioSettings(scenario)}
+	if *numGens > 0 {
+		settings.simulation.numGens = *numGens
+	}
+	if *name != "" {
+		settings.simulation.name = *name
+	}
+	// a thousand time points are enough to classify the end of every run
+	settings.simulation.sampleEvery = max(1, settings.simulation.numGens/1000)
+
+	fmt.Printf("Removing each of %d species with %d workers...\n", len(ecosystem.species), settings.workers)
+	control, results := KeystoneAnalysis(ecosystem, settings)
+	PrintKeystoneTable(control, results, ecosystem.species)
+
+	filename := "./output/" + settings.simulation.name + "_keystone"
+	WriteKeystoneCSV(results, ecosystem.species, filename+".csv")
+	SavePNG(DrawKeystone(results).img, filename+".png")
+	fmt.Println("Keystone ranking written to " + filename + ".csv and .png")
+}
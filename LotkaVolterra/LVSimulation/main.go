@@ -2,14 +2,22 @@ package main
 
 import (
 	"fmt"
-	"gifhelper"
 	"os"
+	"runtime"
 	"strconv"
 )
 
 func main() {
 	fmt.Println("Simulation of LV model starts!")
 
+	// run a named command instead of the default simulation if one is given
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	fmt.Println("Reading input parameters...")
 
 	// Main function's own input for original testing:
@@ -99,6 +107,9 @@ func main() {
 		}
 	}
 
+	// take in optional species names CLA, e.g. Hare:producer:#ffcc00
+	metadata := ParseSpeciesMetadata(os.Args, 2+numSpecies*numSpecies+2*numSpecies, numSpecies)
+
 	// print out all CLAs in one line
 	fmt.Println("numSpecies:", numSpecies, "pop:", pop, "interactionSlice:", interactionSlice, "rateSlice:", rateSlice)
 
@@ -107,39 +118,127 @@ func main() {
 	interaction := SetInteractionMatrix(transposedSlice, numSpecies)
 	deathGrowth := SetRateMatrix(rateSlice)
 
-	// initialize number of generations and time interval: for simulation
-	numGens := 50000
-	time := 0.002
+	fmt.Println("parameters read! Initilizing ecosystem...")
+
+	// initialize an Ecosystem object
+	initialEcosystem := InitializeEcosystem(numSpecies, pop, metadata, interaction, deathGrowth)
+
+	fmt.Println("Ecosystem initialized!")
+
+	RunSimulation(initialEcosystem, DefaultSettings("test"))
+}
+
+// SimulationSettings holds the parameters of a simulation run and of its output.
+type SimulationSettings struct {
+	numGens         int
+	time            float64
+	name            string          // output files are written to ./output/<name>.*
+	aggregateStages bool            // sum the stages of each species in the GIF, CSV and summary
+	history         HistoryFunction // populations before t = 0 for delayed interactions; nil for a constant history
+	sampleEvery     int             // keep every sampleEvery-th generation, so that large communities fit in memory
+	dashboard       bool            // show a live dashboard in the terminal while simulating
+	animation       string          // "boards" for the circles of DrawEcoBoards (the default), or "lines" for the population curves
+	phasePlane      []int           // two species whose phase-plane trace is drawn next to the population curves; nil for none
+}
+
+// DefaultSettings() takes an output name, and returns the settings used by the command line simulation:
+// 50000 generations with a time interval of 0.002.
+func DefaultSettings(name string) SimulationSettings {
+	return SimulationSettings{
+		numGens:     50000,
+		time:        0.002,
+		name:        name,
+		sampleEvery: 1,
+	}
+}
+
+// RunSimulation() takes an initial *Ecosystem object and the settings of the run.
+// It simulates the ecosystem, draws it as an animated GIF and writes the trajectories and their summary
+// to ./output/<name>.out.gif, ./output/<name>.csv and ./output/<name>_summary.json.
+// It returns the simulated time points, every settings.sampleEvery generations.
+func RunSimulation(initialEcosystem *Ecosystem, settings SimulationSettings) []*Ecosystem {
+	// initialize time interval: for simulation
+	time := settings.time
+	name := settings.name
+	sampleEvery := max(1, settings.sampleEvery)
 
 	// initialize canvas width and frequency: for drawing
 	canvasWidth := 500
-	frequency := 200
+	frequency := max(1, 200/sampleEvery)
+	if initialEcosystem.model != "" {
+		// every generation of a discrete model is a frame
+		frequency = 1
+	}
 
-	fmt.Println("parameters read! Initilizing ecosystem...")
+	fmt.Println("Simulating ecosystem...")
 
-	// initialize an Ecosystem object
-	initialEcosystem := InitializeEcosystem(numSpecies, pop, interaction, deathGrowth)
+	var timePoints []*Ecosystem
+	if settings.dashboard {
+		timePoints = SimulateWithDashboard(initialEcosystem, settings)
+	} else {
+		timePoints = SimulateWithSettings(initialEcosystem, settings)
+	}
 
-	fmt.Println("Ecosystem initialized! Simulating ecosystem...")
+	// initialize number of time points discarded as a transient: for summary statistics
+	// (counted on the time points simulated, which are fewer than numGens if the run was aborted)
+	transient := (len(timePoints) - 1) / 5
 
-	timePoints := SimulateEcosystem(initialEcosystem, numGens, time)
+	// the outputs show one value per species when the stages are aggregated
+	outputPoints := timePoints
+	if settings.aggregateStages {
+		outputPoints = AggregateStages(timePoints)
+	}
 
 	// drawing ecosystem gifs
 	fmt.Println("Simulation done! Drawing the ecosystem...")
 
-	images := DrawEcoBoards(timePoints, canvasWidth, frequency)
-
-	fmt.Println("Images drawn!")
+	var numFrames int
+	var render FrameRenderer
+	if settings.animation == "lines" {
+		numFrames, render = LineChartRenderer(outputPoints, time*float64(sampleEvery), frequency, settings.phasePlane)
+	} else {
+		numFrames, render = EcoBoardRenderer(outputPoints, canvasWidth, frequency)
+	}
 
-	fmt.Println("Generating an animated GIF.")
+	// the frames are rendered in parallel and written to the GIF as they are ready
+	fmt.Println("Rendering", numFrames, "frames to an animated GIF.")
 
-	gifhelper.ImagesToGIF(images, "./output/test")
+	WriteGIF("./output/"+name+".out.gif", numFrames, render, runtime.NumCPU())
 
 	fmt.Println("GIF drawn!")
 
 	// writing data to csv file
 	fmt.Println("Writing data to csv file...")
-	WriteToCSV(timePoints, "./output/test.csv")
+	WriteSampledCSV(outputPoints, "./output/"+name+".csv", sampleEvery)
 	fmt.Println("Data written to csv file!")
 
+	// the diets of switching predators change with the prey populations
+	if initialEcosystem.switching != nil && len(DietLinks(initialEcosystem.switching)) > 0 && !settings.aggregateStages {
+		WriteDietCSV(timePoints, sampleEvery, "./output/"+name+"_diet.csv")
+		SavePNG(DrawDiet(timePoints, time*float64(sampleEvery)).img, "./output/"+name+"_diet.png")
+		fmt.Println("Diet composition written to ./output/" + name + "_diet.csv and _diet.png")
+	}
+
+	// summarizing trajectories
+	fmt.Println("Summarizing trajectories...")
+	summaries := SummarizeEcosystem(outputPoints, time*float64(sampleEvery), transient)
+	PrintSummaryTable(summaries)
+	WriteSummaryJSON(summaries, "./output/"+name+"_summary.json")
+	fmt.Println("Summary written to json file!")
+
+	return timePoints
+}
+
+// SimulateWithSettings() takes an initial *Ecosystem object and simulation settings, and returns its time points
+// every settings.sampleEvery generations, using the delayed simulation if the ecosystem has delayed interactions.
+func SimulateWithSettings(initialEcosystem *Ecosystem, settings SimulationSettings) []*Ecosystem {
+	sampleEvery := max(1, settings.sampleEvery)
+
+	if initialEcosystem.model != "" {
+		return SimulateDiscrete(initialEcosystem, settings.numGens, sampleEvery)
+	}
+	if initialEcosystem.delay != nil {
+		return SimulateDelayEcosystemSampled(initialEcosystem, settings.numGens, settings.time, settings.history, sampleEvery)
+	}
+	return SimulateEcosystemSampled(initialEcosystem, settings.numGens, settings.time, sampleEvery)
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"strconv"
+)
+
+// margins of the plotting area inside a Plot image, in pixels
+const (
+	plotMarginLeft   = 100
+	plotMarginRight  = 20
+	plotMarginTop    = 60
+	plotMarginBottom = 55
+	legendLineHeight = 20
+)
+
+// Plot is a white image with a rectangular plotting area mapping the ranges [xMin, xMax] and [yMin, yMax],
+// used to draw the PNG figures of the analysis commands.
+type Plot struct {
+	img                    *image.RGBA
+	area                   image.Rectangle // pixels of the plotting area
+	xMin, xMax, yMin, yMax float64
+}
+
+// NewPlot() takes the size of the plotting area in pixels, the ranges of its axes and the number of legend lines
+// to leave room for under the axes. It returns a Plot with a white background.
+func NewPlot(width, height int, xMin, xMax, yMin, yMax float64, legendLines int) *Plot {
+	if xMax <= xMin || yMax <= yMin {
+		panic("Error: empty range given for a plot axis.")
+	}
+
+	totalWidth := plotMarginLeft + width + plotMarginRight
+	totalHeight := plotMarginTop + height + plotMarginBottom + legendLines*legendLineHeight + 5
+
+	plot := &Plot{
+		img:  image.NewRGBA(image.Rect(0, 0, totalWidth, totalHeight)),
+		area: image.Rect(plotMarginLeft, plotMarginTop, plotMarginLeft+width, plotMarginTop+height),
+		xMin: xMin,
+		xMax: xMax,
+		yMin: yMin,
+		yMax: yMax,
+	}
+	draw.Draw(plot.img, plot.img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	return plot
+}
+
+// PlotPosition() takes a Plot and a point in data coordinates, and returns its pixel position.
+// The y axis points up, unlike the pixel rows.
+func PlotPosition(plot *Plot, x, y float64) (int, int) {
+	px := float64(plot.area.Min.X) + (x-plot.xMin)/(plot.xMax-plot.xMin)*float64(plot.area.Dx())
+	py := float64(plot.area.Max.Y) - (y-plot.yMin)/(plot.yMax-plot.yMin)*float64(plot.area.Dy())
+	return int(math.Round(px)), int(math.Round(py))
+}
+
+// PlotRect() fills the rectangle between two corners given in data coordinates, clipped to the plotting area.
+func PlotRect(plot *Plot, x0, y0, x1, y1 float64, c color.Color) {
+	px0, py0 := PlotPosition(plot, x0, y0)
+	px1, py1 := PlotPosition(plot, x1, y1)
+	rect := image.Rect(px0, py0, px1, py1).Intersect(plot.area)
+	draw.Draw(plot.img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// PlotPoint() draws a square marker of the given size in pixels centered on a point in data coordinates.
+func PlotPoint(plot *Plot, x, y float64, size int, c color.Color) {
+	px, py := PlotPosition(plot, x, y)
+	rect := image.Rect(px-size/2, py-size/2, px-size/2+size, py-size/2+size).Intersect(plot.area)
+	draw.Draw(plot.img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// PlotLine() draws a one pixel wide line between two points in data coordinates, clipped to the plotting area.
+func PlotLine(plot *Plot, x0, y0, x1, y1 float64, c color.Color) {
+	LinePixels(plot, x0, y0, x1, y1, func(px, py int) {
+		plot.img.Set(px, py, c)
+	})
+}
+
+// LinePixels() calls visit with every pixel of the plotting area on the line between two points in data coordinates.
+func LinePixels(plot *Plot, x0, y0, x1, y1 float64, visit func(px, py int)) {
+	px0, py0 := PlotPosition(plot, x0, y0)
+	px1, py1 := PlotPosition(plot, x1, y1)
+
+	// step along the longer side so that the line has no gaps
+	steps := max(abs(px1-px0), abs(py1-py0), 1)
+	for k := 0; k <= steps; k++ {
+		px := px0 + (px1-px0)*k/steps
+		py := py0 + (py1-py0)*k/steps
+		if (image.Point{X: px, Y: py}).In(plot.area) {
+			visit(px, py)
+		}
+	}
+}
+
+// DrawAxes() draws the frame of the plotting area with the range of each axis, a title above it and the axis labels.
+func DrawAxes(plot *Plot, title, xLabel, yLabel string) {
+	black := color.Black
+	area := plot.area
+
+	// frame
+	for x := area.Min.X - 1; x <= area.Max.X; x++ {
+		plot.img.Set(x, area.Min.Y-1, black)
+		plot.img.Set(x, area.Max.Y, black)
+	}
+	for y := area.Min.Y - 1; y <= area.Max.Y; y++ {
+		plot.img.Set(area.Min.X-1, y, black)
+		plot.img.Set(area.Max.X, y, black)
+	}
+
+	// the ends of both axes
+	xMinLabel, xMaxLabel := FormatTick(plot.xMin), FormatTick(plot.xMax)
+	DrawText(plot.img, area.Min.X, area.Max.Y+6, xMinLabel, black, 2)
+	DrawText(plot.img, area.Max.X-TextWidth(xMaxLabel, 2), area.Max.Y+6, xMaxLabel, black, 2)
+
+	yMinLabel, yMaxLabel := FormatTick(plot.yMin), FormatTick(plot.yMax)
+	DrawText(plot.img, area.Min.X-6-TextWidth(yMinLabel, 2), area.Max.Y-2*glyphHeight, yMinLabel, black, 2)
+	DrawText(plot.img, area.Min.X-6-TextWidth(yMaxLabel, 2), area.Min.Y, yMaxLabel, black, 2)
+
+	// labels: the x label under the axis, the y label above the axis and the title centered on top
+	DrawText(plot.img, area.Min.X+(area.Dx()-TextWidth(xLabel, 2))/2, area.Max.Y+26, xLabel, black, 2)
+	DrawText(plot.img, 5, area.Min.Y-2*glyphHeight-8, yLabel, black, 2)
+	DrawText(plot.img, area.Min.X+(area.Dx()-TextWidth(title, 2))/2, 10, title, black, 2)
+}
+
+// DrawPlotLegend() draws one line per label under the axes of a Plot, with a swatch of the matching color.
+// The Plot must have been created with room for len(labels) legend lines.
+func DrawPlotLegend(plot *Plot, labels []string, colors []color.Color) {
+	for k, label := range labels {
+		y := plot.area.Max.Y + plotMarginBottom + k*legendLineHeight
+		swatch := image.Rect(plot.area.Min.X, y, plot.area.Min.X+2*glyphHeight, y+2*glyphHeight)
+		draw.Draw(plot.img, swatch, image.NewUniform(colors[k]), image.Point{}, draw.Src)
+		DrawText(plot.img, swatch.Max.X+8, y, label, color.Black, 2)
+	}
+}
+
+// FormatTick() returns a short text for a number on an axis.
+func FormatTick(value float64) string {
+	return strconv.FormatFloat(value, 'g', 4, 64)
+}
+
+// CategoryColor() returns the k-th color of a palette of well separated colors for categorical data,
+// cycling through the palette when k is larger than its size.
+func CategoryColor(k int) color.Color {
+	palette := []color.RGBA{
+		{31, 119, 180, 255},
+		{255, 127, 14, 255},
+		{44, 160, 44, 255},
+		{214, 39, 40, 255},
+		{148, 103, 189, 255},
+		{140, 86, 75, 255},
+		{227, 119, 194, 255},
+		{127, 127, 127, 255},
+		{188, 189, 34, 255},
+		{23, 190, 207, 255},
+	}
+	return palette[k%len(palette)]
+}
+
+// SavePNG() writes an image to a PNG file.
+func SavePNG(img image.Image, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		fmt.Println("Error writing PNG:", err)
+	}
+}
+
+// abs() returns the absolute value of an int.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
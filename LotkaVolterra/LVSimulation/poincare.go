@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+)
+
+// PoincareSection is the hyperplane where the population of one species equals a value,
+// crossed in a given direction: +1 for increasing populations, -1 for decreasing ones and 0 for both.
+type PoincareSection struct {
+	species   int
+	value     float64
+	direction int
+}
+
+// SectionCrossing is a point where a trajectory crosses a PoincareSection, interpolated between two time points.
+type SectionCrossing struct {
+	time        float64
+	populations []float64
+}
+
+// CrossesSection() takes a PoincareSection and the population of its species at two consecutive time points,
+// and returns true if the trajectory crosses the section between them in the direction of the section.
+func CrossesSection(section PoincareSection, before, after float64) bool {
+	up := before < section.value && after >= section.value
+	down := before > section.value && after <= section.value
+
+	switch section.direction {
+	case 1:
+		return up
+	case -1:
+		return down
+	default:
+		return up || down
+	}
+}
+
+// InterpolateCrossing() takes a PoincareSection, the time and populations of two consecutive time points
+// on either side of it, and returns the crossing, interpolating every population linearly to where
+// the population of the section's species equals the section's value.
+func InterpolateCrossing(section PoincareSection, t0, t1 float64, before, after []float64) SectionCrossing {
+	fraction := (section.value - before[section.species]) / (after[section.species] - before[section.species])
+
+	crossing := SectionCrossing{
+		time:        t0 + fraction*(t1-t0),
+		populations: make([]float64, len(before)),
+	}
+	for i := range before {
+		crossing.populations[i] = before[i] + fraction*(after[i]-before[i])
+	}
+
+	return crossing
+}
+
+// RecordSection() takes the initial *Ecosystem object, a number of generations, a time interval, a number of
+// transient generations, a PoincareSection and a HistoryFunction for delayed interactions (nil for a constant history).
+// It simulates the ecosystem and records every crossing of the section after the transient as the simulation goes,
+// without storing the time points: delayed interactions only keep the time points their largest delay needs.
+func RecordSection(initialEcosystem *Ecosystem, numGens int, time float64, transient int, section PoincareSection, history HistoryFunction) []SectionCrossing {
+	crossings := make([]SectionCrossing, 0)
+	n := len(initialEcosystem.species)
+	previous := make([]float64, n)
+
+	record := func(generation int, current []float64) {
+		if generation > transient && CrossesSection(section, previous[section.species], current[section.species]) {
+			t1 := float64(generation) * time
+			crossings = append(crossings, InterpolateCrossing(section, t1-time, t1, previous, current))
+		}
+		copy(previous, current)
+	}
+
+	if initialEcosystem.delay != nil {
+		state := InitializeDelayState(initialEcosystem, time, history)
+		copy(previous, state.pop)
+		for generation := 1; generation <= numGens; generation++ {
+			StepDelayState(state)
+			record(generation, state.pop)
+		}
+		return crossings
+	}
+
+	state := InitializeLVState(initialEcosystem, time)
+	copy(previous, state.pop)
+	for generation := 1; generation <= numGens; generation++ {
+		StepLVState(state)
+		record(generation, state.pop)
+	}
+
+	return crossings
+}
+
+// WriteSectionCSV() writes the crossings of a section to a CSV file, with the time of every crossing,
+// the time since the previous one and the populations of every species.
+func WriteSectionCSV(crossings []SectionCrossing, species []*Specie, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Crossing", "Time", "Return time"}
+	for _, specie := range species {
+		header = append(header, SpeciesName(specie))
+	}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, crossing := range crossings {
+		returnTime := ""
+		if k > 0 {
+			returnTime = strconv.FormatFloat(crossing.time-crossings[k-1].time, 'f', -1, 64)
+		}
+
+		row := []string{strconv.Itoa(k), strconv.FormatFloat(crossing.time, 'f', -1, 64), returnTime}
+		for _, x := range crossing.populations {
+			row = append(row, strconv.FormatFloat(x, 'f', -1, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// WriteReturnMapCSV() writes the first-return map of one species to a CSV file:
+// its population at every crossing of the section against its population at the next crossing.
+func WriteReturnMapCSV(crossings []SectionCrossing, species []*Specie, index int, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	name := SpeciesName(species[index])
+	if err := writer.Write([]string{"Crossing", name + " (n)", name + " (n+1)"}); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k := 0; k+1 < len(crossings); k++ {
+		row := []string{
+			strconv.Itoa(k),
+			strconv.FormatFloat(crossings[k].populations[index], 'f', -1, 64),
+			strconv.FormatFloat(crossings[k+1].populations[index], 'f', -1, 64),
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// paddedRange() returns the range of a slice of values widened by 5% on each side, so that no point is on the frame.
+func paddedRange(values []float64) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	if high <= low {
+		return low - 1, high + 1
+	}
+	padding := 0.05 * (high - low)
+	return low - padding, high + padding
+}
+
+// DrawScatter() takes the x and y coordinates of a set of points, a title and the axis labels,
+// and returns a Plot of the points. If diagonal is true, the line y = x is drawn too, as for a return map.
+func DrawScatter(xs, ys []float64, title, xLabel, yLabel string, diagonal bool) *Plot {
+	xMin, xMax := paddedRange(xs)
+	yMin, yMax := paddedRange(ys)
+	if diagonal {
+		// both axes show the same population, so they share their range
+		xMin, yMin = math.Min(xMin, yMin), math.Min(xMin, yMin)
+		xMax, yMax = math.Max(xMax, yMax), math.Max(xMax, yMax)
+	}
+
+	plot := NewPlot(500, 500, xMin, xMax, yMin, yMax, 0)
+	if diagonal {
+		PlotLine(plot, xMin, yMin, xMax, yMax, color.Gray{Y: 180})
+	}
+	for k := range xs {
+		PlotPoint(plot, xs[k], ys[k], 3, CategoryColor(0))
+	}
+	DrawAxes(plot, title, xLabel, yLabel)
+
+	return plot
+}
+
+// PoincareCommand records the crossings of a Poincaré section by a scenario file or preset, and writes the section points
+// and the first-return map to ./output/<name>_section.csv and ./output/<name>_return_map.csv, with PNG scatter plots.
+func PoincareCommand(args []string) {
+	flags := flag.NewFlagSet("poincare", flag.ExitOnError)
+	sectionKey := flags.String("species", "0", "index or name of the species defining the section")
+	value := flags.Float64("value", math.NaN(), "population of the section (default the species' interior equilibrium)")
+	directionKey := flags.String("direction", "up", "crossing direction: up, down or both")
+	xKey := flags.String("x", "1", "index or name of the species on the x axis of the section plot")
+	yKey := flags.String("y", "2", "index or name of the species on the y axis of the section plot")
+	returnKey := flags.String("return", "", "index or name of the species of the return map (default the x species)")
+	numGens := flags.Int("gens", 10000000, "number of generations")
+	transientFraction := flags.Float64("transient", 0.1, "fraction of the generations discarded before recording")
+	name := flags.String("name", "", "name of the output files (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the poincare command takes the name of a scenario file or preset.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	ecosystem := BuildEcosystem(scenario)
+	RequireContinuous(ecosystem, "poincare")
+	species := ecosystem.species
+	settings := ScenarioSettings(scenario)
+	if *name != "" {
+		settings.name = *name
+	}
+
+	section := PoincareSection{species: SpeciesIndex(species, *sectionKey), value: *value}
+	switch *directionKey {
+	case "up":
+		section.direction = 1
+	case "down":
+		section.direction = -1
+	case "both":
+		section.direction = 0
+	default:
+		panic("Error: the direction must be up, down or both.")
+	}
+	if math.IsNaN(section.value) {
+		equilibrium, ok := InteriorEquilibrium(ecosystem)
+		if !ok || equilibrium[section.species] <= 0 {
+			panic("Error: no positive interior equilibrium to place the section at; give -value.")
+		}
+		section.value = equilibrium[section.species]
+	}
+
+	x, y := SpeciesIndex(species, *xKey), SpeciesIndex(species, *yKey)
+	returnIndex := x
+	if *returnKey != "" {
+		returnIndex = SpeciesIndex(species, *returnKey)
+	}
+
+	fmt.Printf("Recording crossings of %s = %.4g over %d generations...\n", SpeciesName(species[section.species]), section.value, *numGens)
+	crossings := RecordSection(ecosystem, *numGens, settings.time, int(*transientFraction*float64(*numGens)), section, settings.history)
+	fmt.Println(len(crossings), "crossings recorded.")
+	if len(crossings) < 2 {
+		panic("Error: the trajectory crosses the section less than twice; try another -value or more -gens.")
+	}
+
+	filename := "./output/" + settings.name
+	WriteSectionCSV(crossings, species, filename+"_section.csv")
+	WriteReturnMapCSV(crossings, species, returnIndex, filename+"_return_map.csv")
+
+	sectionX := make([]float64, len(crossings))
+	sectionY := make([]float64, len(crossings))
+	for k, crossing := range crossings {
+		sectionX[k], sectionY[k] = crossing.populations[x], crossing.populations[y]
+	}
+	title := "Section " + SpeciesName(species[section.species]) + " = " + FormatTick(section.value)
+	SavePNG(DrawScatter(sectionX, sectionY, title, SpeciesName(species[x]), SpeciesName(species[y]), false).img, filename+"_section.png")
+
+	returnName := SpeciesName(species[returnIndex])
+	SavePNG(DrawScatter(PopulationAtCrossings(crossings[:len(crossings)-1], returnIndex), PopulationAtCrossings(crossings[1:], returnIndex),
+		"First-return map", returnName+" (n)", returnName+" (n+1)", true).img, filename+"_return_map.png")
+
+	fmt.Println("Section and return map written to " + filename + "_section.csv/.png and _return_map.csv/.png")
+}
+
+// PopulationAtCrossings() returns the population of one species at every crossing.
+func PopulationAtCrossings(crossings []SectionCrossing, index int) []float64 {
+	values := make([]float64, len(crossings))
+	for k, crossing := range crossings {
+		values[k] = crossing.populations[index]
+	}
+	return values
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// presets holds the parameter sets we tested the simulation with, as scenarios that can be used by name
+// wherever a scenario file is accepted. The interaction matrices are written row by row like in a scenario file.
+var presets = map[string]Scenario{
+	// original paper parameters: one prey and two predators
+	"paper": PresetScenario("paper",
+		[]float64{50.0, 10.0, 5.0},
+		[]float64{0.25, -0.5, -0.5},
+		[][]float64{{0, -0.04, -0.04}, {0.04, 0, -0.02}, {0.02, 0.04, 0}}),
+
+	// three competitors reaching a stable equilibrium
+	"stable": PresetScenario("stable",
+		[]float64{0.1, 0.8, 0.3},
+		[]float64{3, 4, 7.2},
+		[][]float64{{-2, -1, 0}, {0, -1, -2}, {-2.6, -1.6, -3}}),
+
+	// three competitors on a limit cycle
+	"limit-cycle": PresetScenario("limit-cycle",
+		[]float64{0.1, 0.8, 0.3},
+		[]float64{3, 4, 7.2},
+		[][]float64{{-0.5, -1, 0}, {0, -1, -2}, {-2.6, -1.6, -3}}),
+
+	// three competitors, one of which goes extinct
+	"extinction-one": PresetScenario("extinction-one",
+		[]float64{0.1, 0.8, 0.3},
+		[]float64{3, 4, 7.2},
+		[][]float64{{-2, -1, -1}, {-1, -1, -2}, {-2.6, -1.6, -3}}),
+
+	// three competitors, two of which go extinct
+	"extinction-two": PresetScenario("extinction-two",
+		[]float64{0.1, 0.8, 0.3},
+		[]float64{3, 4, 7.2},
+		[][]float64{{-0.1, -1, -0.1}, {-1, -0.1, -2}, {-2.6, -0.6, -3}}),
+
+	// four competitors with chaotic dynamics
+	"chaos": PresetScenario("chaos",
+		[]float64{0.1, 0.8, 0.3, 0.5},
+		[]float64{1, 0.72, 1.53, 1.27},
+		[][]float64{
+			{-1, -1.09, -1.52, 0},
+			{0, -0.72, -0.3168, -0.9792},
+			{-3.5649, 0, -1.53, -0.7191},
+			{-1.5367, -0.6477, -0.4445, -1.27},
+		}),
+}
+
+// PresetScenario() takes a name, the initial populations, the growth rates and the interaction matrix row by row,
+// and returns the Scenario of unnamed species with these parameters and the command line simulation settings.
+func PresetScenario(name string, pop, rates []float64, interaction [][]float64) Scenario {
+	scenario := Scenario{Name: name, Interaction: interaction}
+	for i := range pop {
+		scenario.Species = append(scenario.Species, ScenarioSpecies{Population: pop[i], Growth: rates[i]})
+	}
+	return scenario
+}
+
+// PresetNames() returns the names of all presets in alphabetical order.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadScenario() takes the name of a preset or of a scenario file, and returns the Scenario.
+// Presets are looked up first, so a file has to be named with its path or extension (e.g. scenarios/paper.json).
+func LoadScenario(name string) Scenario {
+	if scenario, ok := presets[name]; ok {
+		fmt.Println("Using preset", name)
+		return scenario
+	}
+	return ReadScenario(name)
+}
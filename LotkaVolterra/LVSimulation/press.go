@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// PressSettings holds the parameters of the simulated press perturbations.
+type PressSettings struct {
+	delta      float64 // constant change added to the growth rate of the pressed species
+	workers    int     // number of presses simulated in parallel
+	simulation SimulationSettings
+}
+
+// PressResponse holds the predicted and simulated responses of every species to a press on the growth rate of every species:
+// element (i, j) is the change of the equilibrium population of species i per unit change of the growth rate of species j.
+type PressResponse struct {
+	equilibrium []float64
+	predicted   *mat.Dense
+	simulated   *mat.Dense
+	dynamics    []string // final dynamics of the run pressing every species
+}
+
+// NetEffects() takes a pointer of Ecosystem object and its interior equilibrium, and returns its net effects matrix
+// N = -G⁻¹, whose element (i, j) is the change of the equilibrium population of species i per unit increase of the
+// growth rate of species j, through the direct and all indirect interactions. G is the matrix of the derivatives of the
+// per-capita growth rates at the equilibrium from GrowthGradient(): the interaction matrix A, plus the gradient of the
+// higher-order terms and of the switched attack rates if the ecosystem has them. The second return value is false if G is singular.
+func NetEffects(ecosystem *Ecosystem, equilibrium []float64) (*mat.Dense, bool) {
+	gradient := GrowthGradient(ecosystem, equilibrium)
+
+	var inverse mat.Dense
+	if err := inverse.Inverse(gradient); err != nil {
+		return nil, false
+	}
+	inverse.Scale(-1, &inverse)
+	return &inverse, true
+}
+
+// SimulatePress() takes a pointer of Ecosystem object, its interior equilibrium and press settings. For every species j,
+// it adds settings.delta to the growth rate of j, simulates the ecosystem from the equilibrium, and divides the change of
+// every population by delta. The populations are averaged over the second half of the run, as the time averages of LV
+// populations on a cycle equal the equilibrium. It returns the simulated responses and the final dynamics of every run.
+func SimulatePress(ecosystem *Ecosystem, equilibrium []float64, settings PressSettings) (*mat.Dense, []string) {
+	n := len(ecosystem.species)
+	simulated := mat.NewDense(n, n, nil)
+	dynamics := make([]string, n)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < settings.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				parameter := ContinuationParameter{kind: "r", i: j}
+				pressed := SetParameter(ecosystem, parameter, ParameterValue(ecosystem, parameter)+settings.delta)
+				for _, specie := range pressed.species {
+					specie.population = equilibrium[specie.index]
+				}
+
+				timePoints := SimulateWithSettings(pressed, settings.simulation)
+				dynamics[j] = ClassifyFinalState(timePoints, 0).dynamics
+
+				// every job writes its own column, so no lock is needed
+				window := timePoints[len(timePoints)/2:]
+				for i := 0; i < n; i++ {
+					mean, _, _, _ := DescribeSeries(PopulationSeries(window, i))
+					simulated.Set(i, j, (mean-equilibrium[i])/settings.delta)
+				}
+			}
+		}()
+	}
+	for j := 0; j < n; j++ {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	return simulated, dynamics
+}
+
+// PressAgreement() takes the predicted and simulated responses to press perturbations, and returns the largest absolute
+// difference between them and the fraction of responses whose signs agree.
+func PressAgreement(predicted, simulated mat.Matrix) (float64, float64) {
+	n, m := predicted.Dims()
+	maxError, agree := 0.0, 0
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			p, s := predicted.At(i, j), simulated.At(i, j)
+			maxError = math.Max(maxError, math.Abs(p-s))
+			if sign(p) == sign(s) {
+				agree++
+			}
+		}
+	}
+	return maxError, float64(agree) / float64(n*m)
+}
+
+// WriteMatrixCSV() writes a square matrix of species to a CSV file, with the species names as row and column labels.
+func WriteMatrixCSV(matrix mat.Matrix, species []*Specie, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Species"}
+	for _, specie := range species {
+		header = append(header, SpeciesName(specie))
+	}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for i, specie := range species {
+		row := []string{SpeciesName(specie)}
+		for j := range species {
+			row = append(row, strconv.FormatFloat(matrix.At(i, j), 'f', -1, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// MaxAbsElement() returns the largest absolute value of the elements of a matrix.
+func MaxAbsElement(matrix mat.Matrix) float64 {
+	n, m := matrix.Dims()
+	largest := 0.0
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			largest = math.Max(largest, math.Abs(matrix.At(i, j)))
+		}
+	}
+	return largest
+}
+
+// DivergingColor() takes a value and the largest absolute value of the scale, and returns its color:
+// from white at zero to red for negative and blue for positive values.
+func DivergingColor(value, scale float64) color.Color {
+	t := math.Max(-1, math.Min(1, value/scale))
+	if math.IsNaN(t) {
+		return color.Gray{Y: 128}
+	}
+
+	end := color.RGBA{R: 31, G: 119, B: 180, A: 255}
+	if t < 0 {
+		end, t = color.RGBA{R: 214, G: 39, B: 40, A: 255}, -t
+	}
+	blend := func(c uint8) uint8 { return uint8(math.Round(255 + t*(float64(c)-255))) }
+	return color.RGBA{R: blend(end.R), G: blend(end.G), B: blend(end.B), A: 255}
+}
+
+// DrawHeatmap() takes a square matrix, a color scale and a title, and returns a Plot of the matrix colored with
+// DivergingColor(): element (i, j) is the cell between j and j + 1 on the x axis and between i and i + 1 on the y axis.
+func DrawHeatmap(matrix mat.Matrix, scale float64, title string) *Plot {
+	n, _ := matrix.Dims()
+	plot := NewPlot(400, 400, 0, float64(n), 0, float64(n), 0)
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			PlotRect(plot, float64(j), float64(i), float64(j+1), float64(i+1), DivergingColor(matrix.At(i, j), scale))
+		}
+	}
+	DrawAxes(plot, title, "Pressed species", "Responding species")
+
+	return plot
+}
+
+// SideBySide() takes images, and returns one image with the images next to each other from left to right.
+func SideBySide(images ...image.Image) *image.RGBA {
+	width, height := 0, 0
+	for _, img := range images {
+		width += img.Bounds().Dx()
+		height = max(height, img.Bounds().Dy())
+	}
+
+	combined := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(combined, combined.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	x := 0
+	for _, img := range images {
+		draw.Draw(combined, img.Bounds().Add(image.Pt(x, 0)), img, img.Bounds().Min, draw.Src)
+		x += img.Bounds().Dx()
+	}
+
+	return combined
+}
+
+// PressCommand computes the net effects matrix of a scenario file or preset at its interior equilibrium, which predicts
+// the response of every species to a sustained press on the growth rate of every species, and validates it by simulating
+// each press. The predicted and simulated responses are written to ./output/<name>_net_effects.csv and
+// ./output/<name>_press_simulated.csv, and drawn side by side as heatmaps in ./output/<name>_press.png.
+func PressCommand(args []string) {
+	flags := flag.NewFlagSet("press", flag.ExitOnError)
+	delta := flags.Float64("delta", 0.01, "change added to the growth rate of the pressed species")
+	numGens := flags.Int("gens", 0, "number of generations simulated after every press (default the scenario's)")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of presses simulated in parallel")
+	name := flags.String("name", "", "name of the output files (default the scenario's)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the press command takes the name of a scenario file or preset.")
+	}
+	if *delta == 0 {
+		panic("Error: the press -delta must not be 0.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	ecosystem := BuildEcosystem(scenario)
+	RequireContinuous(ecosystem, "press")
+	species := ecosystem.species
+	settings := PressSettings{delta: *delta, workers: max(1, *workers), simulation: ScenarioSettings(scenario)}
+	if *numGens > 0 {
+		settings.simulation.numGens = *numGens
+	}
+	if *name != "" {
+		settings.simulation.name = *name
+	}
+	settings.simulation.sampleEvery = max(1, settings.simulation.numGens/1000)
+
+	equilibrium, ok := InteriorEquilibrium(ecosystem)
+	if !ok {
+		panic("Error: the ecosystem has no unique interior equilibrium to press.")
+	}
+	for _, x := range equilibrium {
+		if x <= 0 {
+			panic("Error: the interior equilibrium is not feasible; press perturbations need every species present.")
+		}
+	}
+	predicted, ok := NetEffects(ecosystem, equilibrium)
+	if !ok {
+		panic("Error: the derivatives of the growth rates at the equilibrium form a singular matrix.")
+	}
+
+	fmt.Printf("Simulating a press of %g on the growth rate of each of %d species...\n", settings.delta, len(species))
+	simulated, dynamics := SimulatePress(ecosystem, equilibrium, settings)
+	response := PressResponse{equilibrium: equilibrium, predicted: predicted, simulated: simulated, dynamics: dynamics}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Pressed\tPredicted responses\tSimulated responses\tDynamics")
+	for j, specie := range species {
+		predictedColumn, simulatedColumn := "", ""
+		for i := range species {
+			predictedColumn += fmt.Sprintf("%+.3g ", response.predicted.At(i, j))
+			simulatedColumn += fmt.Sprintf("%+.3g ", response.simulated.At(i, j))
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", SpeciesName(specie), predictedColumn, simulatedColumn, response.dynamics[j])
+	}
+	writer.Flush()
+
+	maxError, signAgreement := PressAgreement(response.predicted, response.simulated)
+	fmt.Printf("Largest difference between prediction and simulation: %.3g; signs agree for %.0f%% of the responses.\n", maxError, 100*signAgreement)
+
+	filename := "./output/" + settings.simulation.name
+	WriteMatrixCSV(response.predicted, species, filename+"_net_effects.csv")
+	WriteMatrixCSV(response.simulated, species, filename+"_press_simulated.csv")
+
+	// both heatmaps share the color scale
+	scale := math.Max(MaxAbsElement(response.predicted), MaxAbsElement(response.simulated))
+	title := "Net effects (-inverse of A)"
+	if ecosystem.higherOrder != nil {
+		title = "Net effects (-inverse of G)"
+	}
+	SavePNG(SideBySide(DrawHeatmap(response.predicted, scale, title).img,
+		DrawHeatmap(response.simulated, scale, "Simulated press").img), filename+"_press.png")
+
+	fmt.Println("Responses written to " + filename + "_net_effects.csv, _press_simulated.csv and _press.png")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ElasticNetFit holds a fitted linear model y = intercept + Σ_j coef_j x_j.
+type ElasticNetFit struct {
+	intercept float64
+	coef      []float64
+}
+
+// FitElasticNet() takes a design matrix X (one row per observation), a response y, a penalty lambda and a mixing parameter alpha,
+// and returns the elastic net fit minimising 1/(2n) Σ (y - intercept - X coef)² + lambda (alpha |coef|_1 + (1 - alpha)/2 |coef|²).
+// alpha = 0 is ridge regression and alpha = 1 is the lasso. The columns of X are standardised internally,
+// so the penalty treats them equally, and the intercept is not penalised.
+func FitElasticNet(X [][]float64, y []float64, lambda, alpha float64) ElasticNetFit {
+	n := len(X)
+	p := len(X[0])
+
+	// standardise the columns of X and center y
+	xMean, xScale := columnMoments(X)
+	yMean := 0.0
+	for _, v := range y {
+		yMean += v
+	}
+	yMean /= float64(n)
+
+	Z := make([][]float64, p) // standardised columns
+	for j := 0; j < p; j++ {
+		Z[j] = make([]float64, n)
+		for i := 0; i < n; i++ {
+			Z[j][i] = (X[i][j] - xMean[j]) / xScale[j]
+		}
+	}
+
+	residual := make([]float64, n)
+	for i := range y {
+		residual[i] = y[i] - yMean
+	}
+
+	// cyclic coordinate descent; every standardised column has mean square 1
+	beta := make([]float64, p)
+	for iteration := 0; iteration < 1000; iteration++ {
+		maxChange := 0.0
+		for j := 0; j < p; j++ {
+			// correlation of column j with the partial residual that excludes it
+			rho := 0.0
+			for i := 0; i < n; i++ {
+				rho += Z[j][i] * residual[i]
+			}
+			rho = rho/float64(n) + beta[j]
+
+			updated := softThreshold(rho, lambda*alpha) / (1 + lambda*(1-alpha))
+			if change := updated - beta[j]; change != 0 {
+				for i := 0; i < n; i++ {
+					residual[i] -= change * Z[j][i]
+				}
+				maxChange = math.Max(maxChange, math.Abs(change))
+				beta[j] = updated
+			}
+		}
+
+		if maxChange < 1e-9 {
+			break
+		}
+	}
+
+	// return to the original scale of X
+	fit := ElasticNetFit{intercept: yMean, coef: make([]float64, p)}
+	for j := 0; j < p; j++ {
+		fit.coef[j] = beta[j] / xScale[j]
+		fit.intercept -= fit.coef[j] * xMean[j]
+	}
+
+	return fit
+}
+
+// softThreshold() returns the value shrunk towards 0 by the threshold, or 0 if it is within the threshold.
+func softThreshold(value, threshold float64) float64 {
+	switch {
+	case value > threshold:
+		return value - threshold
+	case value < -threshold:
+		return value + threshold
+	default:
+		return 0
+	}
+}
+
+// columnMoments() returns the mean and the root mean square deviation of every column of X.
+// Constant columns get a scale of 1 so that they can be standardised.
+func columnMoments(X [][]float64) ([]float64, []float64) {
+	n := len(X)
+	p := len(X[0])
+	mean := make([]float64, p)
+	scale := make([]float64, p)
+
+	for _, row := range X {
+		for j, v := range row {
+			mean[j] += v
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(n)
+	}
+
+	for _, row := range X {
+		for j, v := range row {
+			scale[j] += (v - mean[j]) * (v - mean[j])
+		}
+	}
+	for j := range scale {
+		scale[j] = math.Sqrt(scale[j] / float64(n))
+		if scale[j] == 0 {
+			scale[j] = 1
+		}
+	}
+
+	return mean, scale
+}
+
+// Predict() returns the prediction of a fit for one observation.
+func Predict(fit ElasticNetFit, x []float64) float64 {
+	value := fit.intercept
+	for j, c := range fit.coef {
+		value += c * x[j]
+	}
+	return value
+}
+
+// LambdaGrid() takes a design matrix, a response and a mixing parameter, and returns numLambdas penalties
+// spaced evenly on a log scale, from one large enough to shrink every coefficient close to 0
+// down to 1e-4 of the smallest lasso penalty that does.
+func LambdaGrid(X [][]float64, y []float64, alpha float64, numLambdas int) []float64 {
+	n := len(X)
+	xMean, xScale := columnMoments(X)
+	yMean := 0.0
+	for _, v := range y {
+		yMean += v
+	}
+	yMean /= float64(n)
+
+	// the smallest lasso penalty with all coefficients at 0 is max_j |<z_j, y>| / n
+	maxCorrelation := 0.0
+	for j := range xMean {
+		correlation := 0.0
+		for i := 0; i < n; i++ {
+			correlation += (X[i][j] - xMean[j]) / xScale[j] * (y[i] - yMean)
+		}
+		maxCorrelation = math.Max(maxCorrelation, math.Abs(correlation)/float64(n))
+	}
+	if maxCorrelation == 0 {
+		maxCorrelation = 1
+	}
+
+	// ridge penalties never set coefficients to 0, so the largest penalty grows as alpha goes to 0
+	lambdaMax := maxCorrelation / math.Max(alpha, 1e-3)
+	lambdaMin := maxCorrelation * 1e-4
+
+	grid := make([]float64, numLambdas)
+	for k := range grid {
+		grid[k] = lambdaMax * math.Pow(lambdaMin/lambdaMax, float64(k)/float64(numLambdas-1))
+	}
+
+	return grid
+}
+
+// CrossValidateLambda() takes a design matrix, a response, a mixing parameter, a slice of penalties and a number of folds.
+// It returns the penalty with the lowest mean squared prediction error over the folds.
+// The folds are contiguous blocks of observations, so that neighbouring time points are not split between training and testing.
+func CrossValidateLambda(X [][]float64, y []float64, alpha float64, lambdas []float64, numFolds int) float64 {
+	n := len(X)
+	if numFolds < 2 || numFolds > n {
+		panic("Error: number of folds must be between 2 and the number of observations.")
+	}
+
+	best, bestError := lambdas[0], math.Inf(1)
+	for _, lambda := range lambdas {
+		squaredError := 0.0
+		for fold := 0; fold < numFolds; fold++ {
+			start, end := fold*n/numFolds, (fold+1)*n/numFolds
+
+			trainX := append(append([][]float64{}, X[:start]...), X[end:]...)
+			trainY := append(append([]float64{}, y[:start]...), y[end:]...)
+			fit := FitElasticNet(trainX, trainY, lambda, alpha)
+
+			for i := start; i < end; i++ {
+				e := y[i] - Predict(fit, X[i])
+				squaredError += e * e
+			}
+		}
+
+		if squaredError < bestError {
+			best, bestError = lambda, squaredError
+		}
+	}
+
+	return best
+}
+
+// BootstrapElasticNet() takes a design matrix, a response, a penalty, a mixing parameter and a number of bootstrap samples.
+// It refits the model on observations resampled with replacement, and returns the fits of every sample.
+func BootstrapElasticNet(X [][]float64, y []float64, lambda, alpha float64, numSamples int) []ElasticNetFit {
+	n := len(X)
+	fits := make([]ElasticNetFit, numSamples)
+
+	for s := 0; s < numSamples; s++ {
+		sampleX := make([][]float64, n)
+		sampleY := make([]float64, n)
+		for i := 0; i < n; i++ {
+			k := rand.Intn(n)
+			sampleX[i] = X[k]
+			sampleY[i] = y[k]
+		}
+		fits[s] = FitElasticNet(sampleX, sampleY, lambda, alpha)
+	}
+
+	return fits
+}
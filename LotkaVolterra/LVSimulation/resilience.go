@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// envelopePoints is the number of times at which AmplificationEnvelope() evaluates the amplification.
+const envelopePoints = 200
+
+// StabilityMeasures holds the measures of how a stable equilibrium responds to perturbations.
+type StabilityMeasures struct {
+	resilience        float64 // -max Re(λ) of the Jacobian: the asymptotic return rate
+	returnTime        float64 // 1 / resilience
+	reactivity        float64 // largest eigenvalue of the symmetric part of the Jacobian: the initial growth rate of the most amplified perturbation
+	peakAmplification float64 // largest amplification ||exp(J t)|| of any perturbation over time
+	peakTime          float64
+	reactiveDirection []float64 // unit perturbation growing fastest at first: the leading eigenvector of the symmetric part
+}
+
+// ReturnCurve is the distance to an equilibrium after a pulse perturbation, relative to its initial distance.
+type ReturnCurve struct {
+	label      string
+	times      []float64
+	distances  []float64
+	returnTime float64 // first time at which the relative distance falls below 1/e, or NaN if it never does
+}
+
+// MeasureStability() takes the Jacobian at a stable equilibrium, and returns its StabilityMeasures.
+func MeasureStability(jacobian *mat.Dense) StabilityMeasures {
+	n, _ := jacobian.Dims()
+	measures := StabilityMeasures{}
+
+	measures.resilience = -MaxRealPart(Eigenvalues(jacobian))
+	measures.returnTime = 1 / measures.resilience
+
+	// H = (J + Jᵀ) / 2 is symmetric, so its eigenvalues are real and sorted in increasing order
+	symmetric := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			symmetric.SetSym(i, j, (jacobian.At(i, j)+jacobian.At(j, i))/2)
+		}
+	}
+	var eigen mat.EigenSym
+	if ok := eigen.Factorize(symmetric, true); !ok {
+		panic("Error: eigenvalue decomposition of the symmetric part of the Jacobian failed.")
+	}
+	values := eigen.Values(nil)
+	var vectors mat.Dense
+	eigen.VectorsTo(&vectors)
+	measures.reactivity = values[n-1]
+	measures.reactiveDirection = mat.Col(nil, n-1, &vectors)
+
+	measures.peakAmplification, measures.peakTime = AmplificationEnvelope(jacobian, 5*measures.returnTime)
+
+	return measures
+}
+
+// AmplificationEnvelope() takes a Jacobian and a time span, and returns the largest amplification ||exp(J t)||₂
+// of any perturbation between 0 and the time span, with the time at which it happens.
+func AmplificationEnvelope(jacobian *mat.Dense, span float64) (float64, float64) {
+	peak, peakTime := 1.0, 0.0
+
+	var scaled, propagator mat.Dense
+	var svd mat.SVD
+	for k := 1; k <= envelopePoints; k++ {
+		t := span * float64(k) / envelopePoints
+		scaled.Scale(t, jacobian)
+		propagator.Exp(&scaled)
+		if ok := svd.Factorize(&propagator, mat.SVDNone); !ok {
+			panic("Error: singular value decomposition failed.")
+		}
+		if norm := svd.Values(nil)[0]; norm > peak {
+			peak, peakTime = norm, t
+		}
+	}
+
+	return peak, peakTime
+}
+
+// SimulatePulse() takes a pointer of Ecosystem object, its equilibrium, a perturbation, settings and a label.
+// It simulates the ecosystem with SimulateWithSettings() from the equilibrium plus the perturbation (clamped at 0),
+// and returns the ReturnCurve of its distance to the equilibrium every settings.sampleEvery generations.
+func SimulatePulse(ecosystem *Ecosystem, equilibrium, perturbation []float64, settings SimulationSettings, label string) ReturnCurve {
+	pulsed := Copy(ecosystem)
+	for _, specie := range pulsed.species {
+		specie.population = math.Max(0, equilibrium[specie.index]+perturbation[specie.index])
+	}
+
+	// the run starts from the pulse, so it has no history before it
+	settings.history = nil
+	timePoints := SimulateWithSettings(pulsed, settings)
+
+	difference := make([]float64, len(equilibrium))
+	distance := func(timePoint *Ecosystem) float64 {
+		floats.SubTo(difference, timePointPopulations(timePoint), equilibrium)
+		return floats.Norm(difference, 2)
+	}
+
+	curve := ReturnCurve{label: label, returnTime: math.NaN()}
+	initial := distance(timePoints[0])
+	sampleEvery := max(1, settings.sampleEvery)
+	for k, timePoint := range timePoints {
+		t := float64(k*sampleEvery) * settings.time
+		relative := distance(timePoint) / initial
+		curve.times = append(curve.times, t)
+		curve.distances = append(curve.distances, relative)
+		if math.IsNaN(curve.returnTime) && relative <= 1/math.E {
+			curve.returnTime = t
+		}
+	}
+
+	return curve
+}
+
+// PulseCurves() takes a pointer of Ecosystem object, its equilibrium, its StabilityMeasures, a relative pulse size
+// and settings. It simulates a pulse increasing each species by the pulse size times its equilibrium population,
+// and a pulse of the same size as the largest of these along the reactive direction, and returns their ReturnCurves.
+func PulseCurves(ecosystem *Ecosystem, equilibrium []float64, measures StabilityMeasures, pulse float64, settings SimulationSettings) []ReturnCurve {
+	n := len(equilibrium)
+	curves := make([]ReturnCurve, 0, n+1)
+
+	largest := 0.0
+	for i, specie := range ecosystem.species {
+		perturbation := make([]float64, n)
+		perturbation[i] = pulse * equilibrium[i]
+		largest = math.Max(largest, perturbation[i])
+		curves = append(curves, SimulatePulse(ecosystem, equilibrium, perturbation, settings, "Pulse on "+SpeciesName(specie)))
+	}
+
+	reactive := make([]float64, n)
+	floats.ScaleTo(reactive, largest, measures.reactiveDirection)
+	curves = append(curves, SimulatePulse(ecosystem, equilibrium, reactive, settings, "Reactive direction"))
+
+	return curves
+}
+
+// WriteReturnCurvesCSV() writes the return curves of a scenario to a CSV file, with one column per curve.
+func WriteReturnCurvesCSV(curves []ReturnCurve, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Time"}
+	for _, curve := range curves {
+		header = append(header, curve.label)
+	}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, t := range curves[0].times {
+		row := []string{strconv.FormatFloat(t, 'f', -1, 64)}
+		for _, curve := range curves {
+			row = append(row, strconv.FormatFloat(curve.distances[k], 'f', -1, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// DrawReturnCurves() takes the return curves of a scenario and its resilience, and returns a Plot of the log10 of the
+// relative distance to the equilibrium over time, with the asymptotic decay exp(-resilience t) in gray.
+func DrawReturnCurves(curves []ReturnCurve, resilience float64, title string) *Plot {
+	const floor = -4 // distances below 10^-4 are drawn at the bottom of the plot
+
+	logDistance := func(d float64) float64 { return math.Max(floor, math.Log10(d)) }
+	yMax := 0.0
+	for _, curve := range curves {
+		for _, d := range curve.distances {
+			yMax = math.Max(yMax, logDistance(d))
+		}
+	}
+	end := curves[0].times[len(curves[0].times)-1]
+
+	plot := NewPlot(600, 300, 0, end, floor, yMax+0.1, len(curves)+1)
+	// the asymptotic decay is a straight line on the log scale, drawn until it reaches the bottom
+	decayEnd := math.Min(end, -floor*math.Ln10/resilience)
+	PlotLine(plot, 0, 0, decayEnd, -resilience*decayEnd/math.Ln10, color.Gray{Y: 150})
+
+	labels := make([]string, 0, len(curves)+1)
+	colors := make([]color.Color, 0, len(curves)+1)
+	for k, curve := range curves {
+		for m := 1; m < len(curve.times); m++ {
+			PlotLine(plot, curve.times[m-1], logDistance(curve.distances[m-1]), curve.times[m], logDistance(curve.distances[m]), CategoryColor(k))
+		}
+		labels = append(labels, curve.label)
+		colors = append(colors, CategoryColor(k))
+	}
+	labels = append(labels, "exp(-resilience t)")
+	colors = append(colors, color.Gray{Y: 150})
+
+	DrawAxes(plot, title, "Time", "log10 relative distance")
+	DrawPlotLegend(plot, labels, colors)
+
+	return plot
+}
+
+// ResilienceCommand reports the resilience, return time, reactivity and peak transient amplification of the interior
+// equilibrium of one or more scenario files or presets (default all presets), together with the return time measured by
+// simulating pulse perturbations. The comparison is printed and written to ./output/resilience.csv; the return curves of
+// every stable scenario are written to ./output/<name>_return.csv and plotted in ./output/<name>_return.png.
+func ResilienceCommand(args []string) {
+	flags := flag.NewFlagSet("resilience", flag.ExitOnError)
+	pulse := flags.Float64("pulse", 0.1, "size of the pulses relative to the equilibrium populations")
+	numGens := flags.Int("gens", 0, "number of generations simulated after every pulse (default the scenario's)")
+	flags.Parse(args)
+
+	names := flags.Args()
+	if len(names) == 0 {
+		names = PresetNames()
+	}
+
+	file, err := os.Create("./output/resilience.csv")
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+	csvWriter := csv.NewWriter(file)
+	defer csvWriter.Flush()
+	header := []string{"Scenario", "Equilibrium", "Resilience", "Return time", "Reactivity", "Peak amplification", "Peak time", "Simulated return time"}
+	if err := csvWriter.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Scenario\tEquilibrium\tResilience\tReturn time\tReactivity\tPeak amplification\tSimulated return time")
+	for _, name := range names {
+		scenario := LoadScenario(name)
+		ecosystem := BuildEcosystem(scenario)
+		RequireContinuous(ecosystem, "resilience")
+		if ecosystem.delay != nil {
+			panic("Error: the resilience measures come from the Jacobian of the undelayed equations, so the resilience command " +
+				"does not support delayed interactions.")
+		}
+		settings := ScenarioSettings(scenario)
+		if *numGens > 0 {
+			settings.numGens = *numGens
+		}
+		settings.sampleEvery = max(1, settings.numGens/1000)
+
+		report := AnalyzeEquilibrium(ecosystem)
+		status := "stable"
+		switch {
+		case !report.exists:
+			status = "none"
+		case !report.feasible:
+			status = "not feasible"
+		case !report.stable:
+			status = "unstable"
+		}
+		if status != "stable" {
+			fmt.Fprintf(table, "%s\t%s\t-\t-\t-\t-\t-\n", settings.name, status)
+			if err := csvWriter.Write([]string{settings.name, status, "", "", "", "", "", ""}); err != nil {
+				fmt.Println("Error writing row:", err)
+			}
+			continue
+		}
+
+		measures := MeasureStability(Jacobian(ecosystem, report.populations))
+		curves := PulseCurves(ecosystem, report.populations, measures, *pulse, settings)
+
+		// the simulated return time is the mean over the pulses on single species
+		simulated := 0.0
+		for _, curve := range curves[:len(curves)-1] {
+			simulated += curve.returnTime / float64(len(curves)-1)
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%.4g\t%.4g\t%.4g\t%.4g at t=%.3g\t%.4g\n", settings.name, status, measures.resilience,
+			measures.returnTime, measures.reactivity, measures.peakAmplification, measures.peakTime, simulated)
+		row := []string{settings.name, status, strconv.FormatFloat(measures.resilience, 'f', -1, 64),
+			strconv.FormatFloat(measures.returnTime, 'f', -1, 64), strconv.FormatFloat(measures.reactivity, 'f', -1, 64),
+			strconv.FormatFloat(measures.peakAmplification, 'f', -1, 64), strconv.FormatFloat(measures.peakTime, 'f', -1, 64),
+			strconv.FormatFloat(simulated, 'f', -1, 64)}
+		if err := csvWriter.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+		}
+
+		filename := "./output/" + settings.name + "_return"
+		WriteReturnCurvesCSV(curves, filename+".csv")
+		SavePNG(DrawReturnCurves(curves, measures.resilience, "Return after pulses: "+settings.name).img, filename+".png")
+	}
+	table.Flush()
+
+	fmt.Println("Measures written to ./output/resilience.csv, return curves to ./output/<name>_return.csv and .png")
+}
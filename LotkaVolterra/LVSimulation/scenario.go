@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Scenario is an ecosystem and its simulation settings, as read from a JSON scenario file.
+// Unlike the command line, whose interaction matrix is given column by column,
+// row i of the interaction matrix holds the effects of every species on species i.
+type Scenario struct {
+	Name            string             `json:"name"`
+	NumGens         int                `json:"numGens,omitempty"`
+	Time            float64            `json:"time,omitempty"`
+	Species         []ScenarioSpecies  `json:"species"`
+	Interaction     [][]float64        `json:"interaction,omitempty"`
+	Entries         []SparseEntry      `json:"interactionEntries,omitempty"` // nonzero a_ij of a sparse interaction matrix, instead of interaction
+	Sample          int                `json:"sample,omitempty"`             // keep every sample-th generation in the outputs
+	Stages          []StageTransition  `json:"stages,omitempty"`
+	AggregateStages bool               `json:"aggregateStages,omitempty"`
+	Delays          [][]float64        `json:"delays,omitempty"`      // delay τ_ij of every interaction term, row by row
+	History         string             `json:"history,omitempty"`     // CSV file with the populations before t = 0
+	Model           string             `json:"model,omitempty"`       // "lv" (the default) or a discrete-generation model of discreteModels
+	HigherOrder     []HigherOrderEntry `json:"higherOrder,omitempty"` // nonzero b_ijk of the third-order interactions
+	Switching       float64            `json:"switching,omitempty"`   // prey switching exponent of the predators; 0 for fixed attack rates
+	Animation       string             `json:"animation,omitempty"`   // "boards" (the default) or "lines"
+	PhasePlane      string             `json:"phasePlane,omitempty"`  // two species indices such as "0,1" for a phase plane next to the lines
+}
+
+// ScenarioSpecies is one species, or one stage of a stage-structured species, of a Scenario.
+type ScenarioSpecies struct {
+	Name       string  `json:"name"`
+	Stage      string  `json:"stage,omitempty"`
+	Role       string  `json:"role,omitempty"`
+	Color      string  `json:"color,omitempty"` // written as #rrggbb
+	Population float64 `json:"population"`
+	Growth     float64 `json:"growth"` // growth rate, or death rate if negative
+}
+
+// ReadScenario() takes the name of a JSON scenario file, and returns the Scenario it holds.
+func ReadScenario(filename string) Scenario {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		panic(fmt.Sprintf("Error reading scenario %s: %s", filename, err))
+	}
+
+	return scenario
+}
+
+// WriteScenario writes a Scenario to a JSON file.
+func WriteScenario(scenario Scenario, filename string) {
+	data, err := json.MarshalIndent(scenario, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding scenario:", err)
+		return
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		fmt.Println("Error writing scenario:", err)
+	}
+}
+
+// BuildEcosystem() takes a Scenario, and returns the initial Ecosystem object it describes.
+func BuildEcosystem(scenario Scenario) *Ecosystem {
+	numSpecies := len(scenario.Species)
+	if numSpecies == 0 {
+		panic("Error: scenario " + scenario.Name + " has no species.")
+	}
+	sparse := scenario.Interaction == nil && scenario.Entries != nil
+	if !sparse && len(scenario.Interaction) != numSpecies {
+		panic("Error: interaction matrix of scenario " + scenario.Name + " must have one row per species.")
+	}
+
+	pop := make([]float64, numSpecies)
+	rateSlice := make([]float64, numSpecies)
+	interactionSlice := make([]float64, 0, numSpecies*numSpecies)
+	metadata := make([]SpeciesMetadata, numSpecies)
+
+	for i, specie := range scenario.Species {
+		if specie.Population < 0 {
+			panic("Error: negative number given as population of " + specie.Name)
+		}
+
+		pop[i] = specie.Population
+		rateSlice[i] = specie.Growth
+		if !sparse {
+			if len(scenario.Interaction[i]) != numSpecies {
+				panic("Error: interaction matrix of scenario " + scenario.Name + " must be square.")
+			}
+			interactionSlice = append(interactionSlice, scenario.Interaction[i]...)
+		}
+
+		metadata[i] = SpeciesMetadata{name: specie.Name, role: specie.Role, stage: specie.Stage}
+		if specie.Color != "" {
+			metadata[i].color = ParseHexColor(specie.Color)
+		}
+	}
+
+	// the stages of a species share the role given on any of them
+	for i := range metadata {
+		for j := range metadata {
+			if metadata[i].role == "" && metadata[j].name == metadata[i].name {
+				metadata[i].role = metadata[j].role
+			}
+		}
+	}
+
+	var interaction mat.Matrix
+	if sparse {
+		interaction = NewSparseMatrix(numSpecies, numSpecies, scenario.Entries)
+	} else {
+		interaction = SetInteractionMatrix(interactionSlice, numSpecies)
+	}
+	deathGrowth := SetRateMatrix(rateSlice)
+
+	ecosystem := InitializeEcosystem(numSpecies, pop, metadata, interaction, deathGrowth)
+
+	if len(scenario.Stages) > 0 {
+		ecosystem.stageTransfer = BuildStageTransfer(ecosystem.species, scenario.Stages)
+	}
+
+	if scenario.Delays != nil {
+		ecosystem.delay = SetDelayMatrix(scenario.Delays, numSpecies)
+	}
+
+	if len(scenario.HigherOrder) > 0 {
+		ecosystem.higherOrder = NewHigherOrderTensor(numSpecies, scenario.HigherOrder)
+	}
+
+	if scenario.Switching != 0 {
+		ecosystem.switching = NewPreySwitching(ecosystem, scenario.Switching)
+	}
+
+	if scenario.Model != "" && scenario.Model != "lv" {
+		if _, ok := discreteModels[scenario.Model]; !ok {
+			panic("Error: unknown model " + scenario.Model + " of scenario " + scenario.Name)
+		}
+		if ecosystem.stageTransfer != nil || ecosystem.delay != nil {
+			panic("Error: discrete-generation models do not support stages or delays.")
+		}
+		ecosystem.model = scenario.Model
+	}
+
+	return ecosystem
+}
+
+// ScenarioSettings() takes a Scenario, and returns its simulation settings,
+// using the command line defaults for the number of generations and time interval when they are not given.
+// Discrete-generation models default to 500 generations of one time unit.
+func ScenarioSettings(scenario Scenario) SimulationSettings {
+	name := scenario.Name
+	if name == "" {
+		name = "scenario"
+	}
+
+	settings := DefaultSettings(name)
+	if _, ok := discreteModels[scenario.Model]; ok {
+		settings.numGens, settings.time = 500, 1
+	}
+	if scenario.NumGens > 0 {
+		settings.numGens = scenario.NumGens
+	}
+	if scenario.Time > 0 {
+		settings.time = scenario.Time
+	}
+	settings.aggregateStages = scenario.AggregateStages
+	if scenario.Sample > 0 {
+		settings.sampleEvery = scenario.Sample
+	}
+
+	settings.animation = scenario.Animation
+	settings.phasePlane = ParsePhasePlane(scenario.PhasePlane, len(scenario.Species))
+
+	if scenario.History != "" {
+		settings.history = ReadHistoryCSV(scenario.History)
+	}
+
+	return settings
+}
+
+// ScenarioCommand simulates the ecosystem described by a JSON scenario file or a preset, given as the only CLA
+// after the optional flags choosing the animation.
+func ScenarioCommand(args []string) {
+	flags := flag.NewFlagSet("scenario", flag.ExitOnError)
+	animation := flags.String("animation", "", "boards (circles) or lines (population curves); default the scenario's")
+	phase := flags.String("phase", "", "two species indices such as 0,1 whose phase plane is drawn next to the lines")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		panic("Error: the scenario command takes the name of a scenario file or preset.")
+	}
+
+	scenario := LoadScenario(flags.Arg(0))
+	fmt.Println("Scenario", scenario.Name, "read with", len(scenario.Species), "species.")
+
+	initialEcosystem := BuildEcosystem(scenario)
+
+	settings := ScenarioSettings(scenario)
+	if *animation != "" {
+		settings.animation = *animation
+	}
+	if *phase != "" {
+		settings.phasePlane = ParsePhasePlane(*phase, len(scenario.Species))
+		if *animation == "" {
+			settings.animation = "lines"
+		}
+	}
+	if settings.animation != "" && settings.animation != "boards" && settings.animation != "lines" {
+		panic("Error: the animation must be boards or lines: " + settings.animation)
+	}
+
+	RunSimulation(initialEcosystem, settings)
+}
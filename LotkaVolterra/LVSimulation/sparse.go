@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SparseMatrix is a matrix in compressed sparse row format, for interaction matrices with low connectance.
+// It implements mat.Matrix, so it can be used wherever the dense interaction matrix is.
+type SparseMatrix struct {
+	rows, cols int
+	rowStart   []int // the entries of row i are at positions rowStart[i] to rowStart[i+1]-1
+	colIndex   []int // column of every entry, increasing within each row
+	values     []float64
+}
+
+// SparseEntry is one nonzero entry of a sparse matrix.
+type SparseEntry struct {
+	I     int     `json:"i"`
+	J     int     `json:"j"`
+	Value float64 `json:"value"`
+}
+
+// NewSparseMatrix() takes the dimensions of a matrix and its nonzero entries in any order,
+// and returns the SparseMatrix holding them. Repeated entries are added together.
+func NewSparseMatrix(rows, cols int, entries []SparseEntry) *SparseMatrix {
+	sorted := append([]SparseEntry(nil), entries...)
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].I != sorted[b].I {
+			return sorted[a].I < sorted[b].I
+		}
+		return sorted[a].J < sorted[b].J
+	})
+
+	m := &SparseMatrix{rows: rows, cols: cols, rowStart: make([]int, rows+1)}
+	for k, entry := range sorted {
+		if entry.I < 0 || entry.I >= rows || entry.J < 0 || entry.J >= cols {
+			panic("Error: sparse matrix entry out of range.")
+		}
+
+		// add repeated entries to the previous one
+		last := len(m.values) - 1
+		if k > 0 && last >= 0 && sorted[k-1].I == entry.I && sorted[k-1].J == entry.J {
+			m.values[last] += entry.Value
+			continue
+		}
+
+		m.colIndex = append(m.colIndex, entry.J)
+		m.values = append(m.values, entry.Value)
+		m.rowStart[entry.I+1]++
+	}
+
+	// turn the entry counts of every row into start positions
+	for i := 0; i < rows; i++ {
+		m.rowStart[i+1] += m.rowStart[i]
+	}
+
+	return m
+}
+
+// Dims returns the number of rows and columns of the matrix.
+func (m *SparseMatrix) Dims() (int, int) {
+	return m.rows, m.cols
+}
+
+// At returns the entry at row i and column j, which is 0 if it is not stored.
+func (m *SparseMatrix) At(i, j int) float64 {
+	if i < 0 || i >= m.rows || j < 0 || j >= m.cols {
+		panic(mat.ErrIndexOutOfRange)
+	}
+
+	start, end := m.rowStart[i], m.rowStart[i+1]
+	k := start + sort.SearchInts(m.colIndex[start:end], j)
+	if k < end && m.colIndex[k] == j {
+		return m.values[k]
+	}
+	return 0
+}
+
+// T returns the transpose of the matrix.
+func (m *SparseMatrix) T() mat.Matrix {
+	return mat.Transpose{Matrix: m}
+}
+
+// NumNonzero returns the number of stored entries of the matrix.
+func (m *SparseMatrix) NumNonzero() int {
+	return len(m.values)
+}
+
+// SparseMulVec() computes dst = m * x for a SparseMatrix, using only its stored entries.
+func SparseMulVec(dst []float64, m *SparseMatrix, x []float64) {
+	for i := 0; i < m.rows; i++ {
+		sum := 0.0
+		for k := m.rowStart[i]; k < m.rowStart[i+1]; k++ {
+			sum += m.values[k] * x[m.colIndex[k]]
+		}
+		dst[i] = sum
+	}
+}
+
+// ScaleSparse() returns a new SparseMatrix with every entry of m multiplied by a scalar.
+func ScaleSparse(scalar float64, m *SparseMatrix) *SparseMatrix {
+	scaled := &SparseMatrix{
+		rows:     m.rows,
+		cols:     m.cols,
+		rowStart: m.rowStart,
+		colIndex: m.colIndex,
+		values:   make([]float64, len(m.values)),
+	}
+	for k, v := range m.values {
+		scaled.values[k] = scalar * v
+	}
+	return scaled
+}
+
+// InitializeSparseInteractionMatrix() takes a number of species and a connectance, and returns a random sparse interaction matrix.
+// Like InitializeInteractionMatrix(), every pair of species interacts with a coefficient drawn between -1 and 1,
+// but only with probability equal to the connectance. Every species limits itself with a diagonal entry of -1,
+// which keeps large random communities bounded.
+func InitializeSparseInteractionMatrix(numSpecies int, connectance float64) *SparseMatrix {
+	entries := make([]SparseEntry, 0, numSpecies+int(connectance*float64(numSpecies*numSpecies)))
+
+	for i := 0; i < numSpecies; i++ {
+		entries = append(entries, SparseEntry{I: i, J: i, Value: -1})
+		for j := 0; j < numSpecies; j++ {
+			if i != j && rand.Float64() < connectance {
+				entries = append(entries, SparseEntry{I: i, J: j, Value: rand.Float64()*2 - 1})
+			}
+		}
+	}
+
+	return NewSparseMatrix(numSpecies, numSpecies, entries)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// StageTransition is a linear flow between two stages of the same species.
+// A "maturation" moves individuals from one stage to the next at the given per-capita rate,
+// while a "reproduction" adds individuals to the target stage without removing them from the source stage.
+type StageTransition struct {
+	Species string  `json:"species"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Rate    float64 `json:"rate"`
+	Type    string  `json:"type"` // "maturation" or "reproduction"
+}
+
+// BuildStageTransfer() takes the species slice of an ecosystem and the stage transitions between them,
+// and returns the stage transfer matrix M, so that the stage flows change the populations by M * p per unit time.
+func BuildStageTransfer(species []*Specie, transitions []StageTransition) mat.Matrix {
+	n := len(species)
+	transfer := mat.NewDense(n, n, nil)
+
+	for _, transition := range transitions {
+		from := FindStage(species, transition.Species, transition.From)
+		to := FindStage(species, transition.Species, transition.To)
+		if transition.Rate < 0 {
+			panic("Error: negative rate given for a stage transition of " + transition.Species)
+		}
+
+		switch transition.Type {
+		case "maturation":
+			// individuals leave the source stage and enter the target stage
+			transfer.Set(from, from, transfer.At(from, from)-transition.Rate)
+			transfer.Set(to, from, transfer.At(to, from)+transition.Rate)
+		case "reproduction":
+			// newborns enter the target stage
+			transfer.Set(to, from, transfer.At(to, from)+transition.Rate)
+		default:
+			panic("Error: stage transition type must be maturation or reproduction: " + transition.Type)
+		}
+	}
+
+	return transfer
+}
+
+// FindStage() takes a species slice, a species name and a stage, and returns the index of that stage.
+func FindStage(species []*Specie, name, stage string) int {
+	for _, specie := range species {
+		if specie.name == name && specie.stage == stage {
+			return specie.index
+		}
+	}
+	panic("Error: no stage " + stage + " of species " + name)
+}
+
+// AddStageTransfer() takes the updated population matrix, the stage transfer matrix, the population matrix
+// before the update and the time interval. It returns the updated populations plus ∆t * M * p,
+// with no population going below 0.
+func AddStageTransfer(newP, transfer, p mat.Matrix, deltaTime float64) mat.Matrix {
+	r, c := p.Dims()
+
+	flow := mat.NewDense(r, c, nil)
+	flow.Mul(transfer, p)
+	flow.Scale(deltaTime, flow)
+	flow.Add(flow, newP)
+
+	for i := 0; i < r; i++ {
+		flow.Set(i, 0, math.Max(0, flow.At(i, 0)))
+	}
+
+	return flow
+}
+
+// AggregateStages() takes the time points of a simulation, and returns time points with one species per name,
+// whose population is the sum of the populations of its stages. Species keep the order in which they first appear.
+// The returned ecosystems only hold species, and are meant for output (drawing, CSV and summaries).
+func AggregateStages(timePoints []*Ecosystem) []*Ecosystem {
+	// map every state variable to the index of its species
+	groups := make([]int, len(timePoints[0].species))
+	names := make(map[string]int)
+	first := make([]*Specie, 0)
+	for i, specie := range timePoints[0].species {
+		index, ok := names[specie.name]
+		if !ok || specie.name == "" {
+			index = len(first)
+			names[specie.name] = index
+			first = append(first, specie)
+		}
+		groups[i] = index
+	}
+
+	aggregated := make([]*Ecosystem, len(timePoints))
+	for t, ecosystem := range timePoints {
+		species := make([]*Specie, len(first))
+		for i, specie := range first {
+			species[i] = &Specie{
+				index: i,
+				name:  specie.name,
+				color: specie.color,
+				role:  specie.role,
+			}
+		}
+
+		for i, specie := range ecosystem.species {
+			species[groups[i]].population += specie.population
+		}
+
+		aggregated[t] = &Ecosystem{species: species}
+	}
+
+	return aggregated
+}
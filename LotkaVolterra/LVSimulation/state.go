@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// LVState holds the populations of an ecosystem as a preallocated state vector, together with everything the update
+// needs that does not change between steps, so that a step does not rebuild the F, H and p matrices of UpdatePopulation.
+type LVState struct {
+	ecosystem *Ecosystem // the ecosystem the state was initialized from, whose matrices are shared by the snapshots
+	time      float64
+	pop       []float64 // populations, indexed by species index
+	f         []float64 // F = ∆t · G + 1
+	h         mat.Matrix
+	sparseH   *SparseMatrix // H = ∆t · D when the interaction matrix is sparse, otherwise nil
+	hp        []float64     // scratch space for H · p
+	flow      []float64     // scratch space for the stage flows
+	higher    []float64     // scratch space for ∆t times the higher-order terms
+	switchedH *mat.Dense    // H when the predators switch prey, updated at every step; otherwise nil
+
+	// vector views of pop, hp and flow for the dense matrix products
+	popVec, hpVec, flowVec *mat.VecDense
+}
+
+// InitializeLVState() takes a pointer of Ecosystem object and a time interval, and returns its LVState.
+func InitializeLVState(ecosystem *Ecosystem, time float64) *LVState {
+	n := len(ecosystem.species)
+	state := &LVState{
+		ecosystem: ecosystem,
+		time:      time,
+		pop:       make([]float64, n),
+		f:         make([]float64, n),
+		hp:        make([]float64, n),
+	}
+
+	for _, specie := range ecosystem.species {
+		state.pop[specie.index] = specie.population
+	}
+	state.popVec = mat.NewVecDense(n, state.pop)
+	state.hpVec = mat.NewVecDense(n, state.hp)
+
+	for i := 0; i < n; i++ {
+		state.f[i] = ecosystem.deathGrowth.At(i, 0)*time + 1
+	}
+
+	// H is scaled once, keeping the sparse format if the interaction matrix has it,
+	// except for the predator-prey elements that prey switching sets again at every step
+	if ecosystem.switching != nil {
+		state.switchedH = mat.DenseCopyOf(CalculateH(ecosystem.interaction, time))
+		state.h = state.switchedH
+	} else if sparse, ok := ecosystem.interaction.(*SparseMatrix); ok {
+		state.sparseH = ScaleSparse(time, sparse)
+	} else {
+		state.h = CalculateH(ecosystem.interaction, time)
+	}
+
+	if ecosystem.higherOrder != nil {
+		state.higher = make([]float64, n)
+	}
+
+	if ecosystem.stageTransfer != nil {
+		state.flow = make([]float64, n)
+		state.flowVec = mat.NewVecDense(n, state.flow)
+	}
+
+	return state
+}
+
+// StepLVState() advances an LVState by one time interval with the same update as UpdatePopulation:
+// newPop = (H x p + F) * p, plus the higher-order terms and the stage flows, with no population going below 0.
+func StepLVState(state *LVState) {
+	if state.switchedH != nil {
+		ApplySwitching(state.ecosystem.switching, state.ecosystem.interaction, state.pop, state.time, state.switchedH)
+	}
+
+	// hp = H x p
+	if state.sparseH != nil {
+		SparseMulVec(state.hp, state.sparseH, state.pop)
+	} else {
+		state.hpVec.MulVec(state.h, state.popVec)
+	}
+
+	// the stage flows use the populations before the update
+	if state.flow != nil {
+		state.flowVec.MulVec(state.ecosystem.stageTransfer, state.popVec)
+	}
+
+	// the higher-order terms also use the populations before the update
+	if state.higher != nil {
+		clear(state.higher)
+		AddHigherOrderTerms(state.ecosystem.higherOrder, state.pop, state.time, state.higher)
+		floats.Add(state.hp, state.higher)
+	}
+
+	for i, p := range state.pop {
+		state.pop[i] = math.Max(0, (state.hp[i]+state.f[i])*p)
+		if state.flow != nil {
+			state.pop[i] = math.Max(0, state.pop[i]+state.time*state.flow[i])
+		}
+	}
+}
+
+// EcosystemFromState() takes an LVState, and returns a new Ecosystem object with its current populations.
+// The returned ecosystem shares the interaction, deathGrowth and stage transfer matrices of the state's ecosystem,
+// which must therefore not be modified during the simulation.
+func EcosystemFromState(state *LVState) *Ecosystem {
+	newEcosystem := &Ecosystem{
+		species:       CopySpecies(state.ecosystem.species),
+		interaction:   state.ecosystem.interaction,
+		deathGrowth:   state.ecosystem.deathGrowth,
+		stageTransfer: state.ecosystem.stageTransfer,
+		delay:         state.ecosystem.delay,
+		model:         state.ecosystem.model,
+		higherOrder:   state.ecosystem.higherOrder,
+		switching:     state.ecosystem.switching,
+	}
+
+	for _, specie := range newEcosystem.species {
+		specie.population = state.pop[specie.index]
+	}
+
+	return newEcosystem
+}
+
+// SimulateEcosystemSampled() takes the initial *Ecosystem object, a number of generations, a time interval and a sampling interval.
+// It simulates the ecosystem like SimulateEcosystem, but only keeps every sampleEvery-th time point,
+// so that large communities can be run for many generations without storing every step.
+// It returns the time points 0, sampleEvery, 2*sampleEvery, ... up to numGens.
+func SimulateEcosystemSampled(initialEcosystem *Ecosystem, numGens int, time float64, sampleEvery int) []*Ecosystem {
+	if sampleEvery <= 0 {
+		panic("Error: nonpositive number given as sampling interval.")
+	}
+
+	timePoints := make([]*Ecosystem, 0, numGens/sampleEvery+1)
+	timePoints = append(timePoints, initialEcosystem)
+
+	state := InitializeLVState(initialEcosystem, time)
+	for i := 1; i < numGens+1; i++ {
+		StepLVState(state)
+		if i%sampleEvery == 0 {
+			timePoints = append(timePoints, EcosystemFromState(state))
+		}
+	}
+
+	return timePoints
+}
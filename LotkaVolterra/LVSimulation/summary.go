@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/stat"
+)
+
+// extinctionThreshold is the population below which a species is treated as extinct.
+const extinctionThreshold = 1e-6
+
+// SpeciesSummary holds the summary statistics of one species' trajectory after the transient is discarded.
+// Optional values are pointers so that they are written as null in JSON when they do not exist.
+type SpeciesSummary struct {
+	Index          int      `json:"index"`
+	Name           string   `json:"name"`
+	Role           string   `json:"role"`
+	Mean           float64  `json:"mean"`
+	Min            float64  `json:"min"`
+	Max            float64  `json:"max"`
+	CV             float64  `json:"cv"`
+	PeakPeriod     *float64 `json:"peakPeriod"`
+	SpectralPeriod *float64 `json:"spectralPeriod"`
+	PhaseLag       *float64 `json:"phaseLag"`
+	ExtinctionTime *float64 `json:"extinctionTime"`
+}
+
+// SummarizeEcosystem() takes the time points of a simulation, the time interval used to produce them,
+// and the number of initial generations to discard as a transient.
+// It returns a SpeciesSummary for every species. Periods, phase lags and extinction times are in time units,
+// and the phase lag of each species is measured relative to the first producer (the prey), or the first species if there is none.
+func SummarizeEcosystem(timePoints []*Ecosystem, time float64, transient int) []SpeciesSummary {
+	if transient < 0 || transient >= len(timePoints) {
+		panic("Error: transient must be smaller than the number of time points.")
+	}
+
+	numSpecies := len(timePoints[0].species)
+	summaries := make([]SpeciesSummary, numSpecies)
+
+	// the prey series is used as the reference for phase lags
+	reference := 0
+	for i := numSpecies - 1; i >= 0; i-- {
+		if timePoints[0].species[i].role == "producer" {
+			reference = i
+		}
+	}
+	prey := PopulationSeries(timePoints[transient:], reference)
+
+	for i := 0; i < numSpecies; i++ {
+		series := PopulationSeries(timePoints[transient:], i)
+
+		specie := timePoints[0].species[i]
+		summary := SpeciesSummary{Index: i, Name: SpeciesName(specie), Role: specie.role}
+		summary.Mean, summary.Min, summary.Max, summary.CV = DescribeSeries(series)
+		summary.PeakPeriod = PeakPeriod(series, time)
+		summary.SpectralPeriod = SpectralPeriod(series, time)
+		if i != reference {
+			summary.PhaseLag = PhaseLag(prey, series, summary.SpectralPeriod, time)
+		}
+
+		// extinction is checked over the full run, including the transient
+		summary.ExtinctionTime = ExtinctionTime(PopulationSeries(timePoints, i), time)
+
+		summaries[i] = summary
+	}
+
+	return summaries
+}
+
+// PopulationSeries() takes a slice of time points and a species index,
+// and returns the population of that species at every time point.
+func PopulationSeries(timePoints []*Ecosystem, index int) []float64 {
+	series := make([]float64, len(timePoints))
+	for t, ecosystem := range timePoints {
+		series[t] = ecosystem.species[index].population
+	}
+	return series
+}
+
+// DescribeSeries() returns the mean, minimum, maximum and coefficient of variation of a series.
+// The coefficient of variation is 0 when the mean is 0.
+func DescribeSeries(series []float64) (float64, float64, float64, float64) {
+	mean, std := stat.MeanStdDev(series, nil)
+
+	min, max := series[0], series[0]
+	for _, v := range series {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+
+	cv := 0.0
+	if mean != 0 {
+		cv = std / mean
+	}
+
+	return mean, min, max, cv
+}
+
+// PeakPeriod() estimates the oscillation period of a series as the mean interval between its local maxima.
+// Only maxima that rise above the mean are counted, so that numerical noise around an equilibrium is ignored.
+// It returns nil if fewer than two peaks are found.
+func PeakPeriod(series []float64, time float64) *float64 {
+	mean, _, _, cv := DescribeSeries(series)
+	if cv < 1e-6 {
+		return nil
+	}
+
+	peaks := make([]int, 0)
+	for t := 1; t < len(series)-1; t++ {
+		if series[t] > mean && series[t] > series[t-1] && series[t] >= series[t+1] {
+			// skip plateaus and small wiggles by requiring the series to drop below the mean between peaks
+			if len(peaks) > 0 && !dropsBelow(series[peaks[len(peaks)-1]:t], mean) {
+				continue
+			}
+			peaks = append(peaks, t)
+		}
+	}
+
+	if len(peaks) < 2 {
+		return nil
+	}
+
+	period := float64(peaks[len(peaks)-1]-peaks[0]) / float64(len(peaks)-1) * time
+	return &period
+}
+
+// dropsBelow() reports whether any value in the series is below the given level.
+func dropsBelow(series []float64, level float64) bool {
+	for _, v := range series {
+		if v < level {
+			return true
+		}
+	}
+	return false
+}
+
+// SpectralPeriod() estimates the dominant oscillation period of a series from its power spectrum.
+// The mean is removed first, and the zero frequency is ignored.
+// It returns nil if the series is constant or the strongest frequency does not complete two cycles in the window.
+func SpectralPeriod(series []float64, time float64) *float64 {
+	n := len(series)
+	if n < 4 {
+		return nil
+	}
+
+	mean, _, _, cv := DescribeSeries(series)
+	if cv < 1e-6 {
+		return nil
+	}
+
+	// remove the mean so that the zero frequency does not dominate
+	centered := make([]float64, n)
+	for t, v := range series {
+		centered[t] = v - mean
+	}
+
+	fft := fourier.NewFFT(n)
+	coefficients := fft.Coefficients(nil, centered)
+
+	best, bestPower := 0, 0.0
+	for k := 1; k < len(coefficients); k++ {
+		c := coefficients[k]
+		power := real(c)*real(c) + imag(c)*imag(c)
+		if power > bestPower {
+			best, bestPower = k, power
+		}
+	}
+
+	// a period longer than half the window cannot be trusted
+	if best < 2 {
+		return nil
+	}
+
+	period := time / fft.Freq(best)
+	return &period
+}
+
+// PhaseLag() takes a reference series, a second series, the period of the second series and the time interval.
+// It returns the lag (in time units) at which the cross-correlation between the two series is maximal,
+// searched within one period. A positive lag means the second series follows the reference.
+// It returns nil if there is no period to search within.
+func PhaseLag(reference, series []float64, period *float64, time float64) *float64 {
+	if period == nil {
+		return nil
+	}
+
+	maxLag := int(*period / time)
+	if maxLag >= len(series) {
+		return nil
+	}
+
+	refMean := stat.Mean(reference, nil)
+	seriesMean := stat.Mean(series, nil)
+
+	best, bestCorrelation := 0, math.Inf(-1)
+	for lag := 0; lag <= maxLag; lag++ {
+		correlation := 0.0
+		for t := 0; t+lag < len(series); t++ {
+			correlation += (reference[t] - refMean) * (series[t+lag] - seriesMean)
+		}
+		correlation /= float64(len(series) - lag)
+
+		if correlation > bestCorrelation {
+			best, bestCorrelation = lag, correlation
+		}
+	}
+
+	lag := float64(best) * time
+	return &lag
+}
+
+// ExtinctionTime() returns the first time after which a series stays below extinctionThreshold,
+// or nil if the species never goes extinct.
+func ExtinctionTime(series []float64, time float64) *float64 {
+	extinct := -1
+	for t, v := range series {
+		if v < extinctionThreshold {
+			if extinct < 0 {
+				extinct = t
+			}
+		} else {
+			extinct = -1
+		}
+	}
+
+	if extinct < 0 {
+		return nil
+	}
+
+	extinctionTime := float64(extinct) * time
+	return &extinctionTime
+}
+
+// WriteSummaryJSON writes the species summaries to a JSON file.
+func WriteSummaryJSON(summaries []SpeciesSummary, filename string) {
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding summary:", err)
+		return
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		fmt.Println("Error writing summary:", err)
+	}
+}
+
+// PrintSummaryTable prints the species summaries as a compact table on stdout.
+func PrintSummaryTable(summaries []SpeciesSummary) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "Species\tRole\tMean\tMin\tMax\tCV\tPeriod(peaks)\tPeriod(FFT)\tLag\tExtinct at\t")
+
+	for _, s := range summaries {
+		fmt.Fprintf(writer, "%s\t%s\t%.4g\t%.4g\t%.4g\t%.3f\t%s\t%s\t%s\t%s\t\n",
+			s.Name, s.Role, s.Mean, s.Min, s.Max, s.CV,
+			formatOptional(s.PeakPeriod), formatOptional(s.SpectralPeriod),
+			formatOptional(s.PhaseLag), formatOptional(s.ExtinctionTime))
+	}
+
+	writer.Flush()
+}
+
+// formatOptional formats an optional value for the summary table, using "-" when it is missing.
+func formatOptional(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.4g", *v)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// PreySwitching holds the adaptive diets of the predators of an ecosystem. Every predator j keeps its total attack rate
+// T_j = Σ_k |a_kj| over its prey k, but reallocates it towards abundant prey: its attack rate on prey i becomes
+// α_ij = T_j |a_ij| x_i^m / Σ_k |a_kj| x_k^m, where m is the switching exponent. The conversion a_ji of prey i into
+// predator j is scaled by the same factor α_ij / |a_ij|. With m = 0 the attack rates stay as in the interaction matrix.
+type PreySwitching struct {
+	exponent float64
+	prey     [][]int   // prey of every predator, from the food web of the interaction matrix; empty for other species
+	capacity []float64 // total attack rate T_j of every predator
+}
+
+// DietLink is the diet share of one prey in the consumption of one predator.
+type DietLink struct {
+	predator, prey int
+}
+
+// NewPreySwitching() takes an Ecosystem and a switching exponent, and returns the PreySwitching of its predators,
+// whose prey are found with InferFoodWeb().
+func NewPreySwitching(ecosystem *Ecosystem, exponent float64) *PreySwitching {
+	if exponent < 0 {
+		panic("Error: negative number given as switching exponent.")
+	}
+
+	web := InferFoodWeb(ecosystem)
+	n := len(ecosystem.species)
+	switching := &PreySwitching{exponent: exponent, prey: make([][]int, n), capacity: make([]float64, n)}
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			if web.eats[j][i] {
+				switching.prey[j] = append(switching.prey[j], i)
+				switching.capacity[j] -= ecosystem.interaction.At(i, j)
+			}
+		}
+	}
+
+	return switching
+}
+
+// AttackRates() takes a PreySwitching, the base interaction matrix, the populations and a predator, and returns
+// the attack rates α_ij of the predator on each of its prey, in the order of switching.prey[j].
+// If none of its prey is present, the attack rates of the interaction matrix are returned.
+func AttackRates(switching *PreySwitching, interaction mat.Matrix, x []float64, j int) []float64 {
+	prey := switching.prey[j]
+	rates := make([]float64, len(prey))
+
+	total := 0.0
+	for k, i := range prey {
+		rates[k] = -interaction.At(i, j) * math.Pow(x[i], switching.exponent)
+		total += rates[k]
+	}
+	for k, i := range prey {
+		if total > 0 {
+			rates[k] *= switching.capacity[j] / total
+		} else {
+			rates[k] = -interaction.At(i, j)
+		}
+	}
+
+	return rates
+}
+
+// ApplySwitching() takes a PreySwitching, the base interaction matrix, the populations and a scale, and sets the
+// predator-prey elements of m to scale times the switched interactions: -α_ij for the effect of predator j on prey i,
+// and a_ji α_ij / |a_ij| for the effect of prey i on predator j. The other elements of m are left unchanged.
+func ApplySwitching(switching *PreySwitching, interaction mat.Matrix, x []float64, scale float64, m *mat.Dense) {
+	for j, prey := range switching.prey {
+		if len(prey) == 0 {
+			continue
+		}
+		rates := AttackRates(switching, interaction, x, j)
+		for k, i := range prey {
+			attack := -interaction.At(i, j)
+			m.Set(i, j, -scale*rates[k])
+			m.Set(j, i, scale*interaction.At(j, i)*rates[k]/attack)
+		}
+	}
+}
+
+// EffectiveInteraction() takes a pointer of Ecosystem object and a slice of populations, and returns the interaction
+// matrix acting at those populations: the interaction matrix itself, or its switched version if the predators switch prey.
+func EffectiveInteraction(ecosystem *Ecosystem, x []float64) mat.Matrix {
+	if ecosystem.switching == nil {
+		return ecosystem.interaction
+	}
+
+	effective := mat.DenseCopyOf(ecosystem.interaction)
+	ApplySwitching(ecosystem.switching, ecosystem.interaction, x, 1, effective)
+	return effective
+}
+
+// AddSwitchingGradient() takes a PreySwitching, the base interaction matrix and a slice of populations, and adds the
+// derivatives of the switched terms of the per-capita growth rates to m: element (i, l) gets the derivative of
+// Σ_j α'_ij x_j with respect to x_l, where α' is the switched interaction matrix, as the attack rates depend on the prey.
+// If weights is not nil, row i is multiplied by weights[i]. Predators whose prey are all absent add nothing.
+func AddSwitchingGradient(switching *PreySwitching, interaction mat.Matrix, x, weights []float64, m *mat.Dense) {
+	exponent := switching.exponent
+	for j, prey := range switching.prey {
+		if len(prey) == 0 {
+			continue
+		}
+
+		// w_k = |a_kj| x_k^m and its derivative, whose sum S normalizes the attack rates
+		w := make([]float64, len(prey))
+		slope := make([]float64, len(prey))
+		total := 0.0
+		for k, i := range prey {
+			attack := -interaction.At(i, j)
+			w[k] = attack * math.Pow(x[i], exponent)
+			if x[i] > 0 || exponent >= 1 {
+				slope[k] = attack * exponent * math.Pow(x[i], exponent-1)
+			}
+			total += w[k]
+		}
+		if total <= 0 {
+			continue
+		}
+
+		for k, i := range prey {
+			attack := -interaction.At(i, j)
+			for l, h := range prey {
+				// ∂α_ij/∂x_h = T_j (δ_ih w_i' S - w_i w_h') / S²
+				derivative := -w[k] * slope[l]
+				if k == l {
+					derivative += slope[k] * total
+				}
+				derivative *= switching.capacity[j] / (total * total)
+
+				preyWeight, predatorWeight := 1.0, 1.0
+				if weights != nil {
+					preyWeight, predatorWeight = weights[i], weights[j]
+				}
+				m.Set(i, h, m.At(i, h)-preyWeight*derivative*x[j])
+				m.Set(j, h, m.At(j, h)+predatorWeight*interaction.At(j, i)/attack*derivative*x[i])
+			}
+		}
+	}
+}
+
+// DietLinks() takes a PreySwitching, and returns its predator-prey links of predators with more than one prey,
+// whose diets can change.
+func DietLinks(switching *PreySwitching) []DietLink {
+	var links []DietLink
+	for j, prey := range switching.prey {
+		if len(prey) < 2 {
+			continue
+		}
+		for _, i := range prey {
+			links = append(links, DietLink{predator: j, prey: i})
+		}
+	}
+	return links
+}
+
+// DietComposition() takes a pointer of Ecosystem object with prey switching and a slice of populations, and returns
+// the diet share α_ij x_i / Σ_k α_kj x_k of every link of DietLinks(), or NaN for predators whose prey are all absent.
+func DietComposition(ecosystem *Ecosystem, x []float64) []float64 {
+	switching := ecosystem.switching
+	shares := make([]float64, 0)
+	for j, prey := range switching.prey {
+		if len(prey) < 2 {
+			continue
+		}
+
+		rates := AttackRates(switching, ecosystem.interaction, x, j)
+		total := 0.0
+		for k, i := range prey {
+			total += rates[k] * x[i]
+		}
+		for k, i := range prey {
+			shares = append(shares, rates[k]*x[i]/total)
+		}
+	}
+	return shares
+}
+
+// dietLabel() returns the name of a DietLink, such as "Fox on Rabbit".
+func dietLabel(link DietLink, species []*Specie) string {
+	return SpeciesName(species[link.predator]) + " on " + SpeciesName(species[link.prey])
+}
+
+// timePointPopulations() returns the populations of a time point, indexed by species index.
+func timePointPopulations(ecosystem *Ecosystem) []float64 {
+	x := make([]float64, len(ecosystem.species))
+	for _, specie := range ecosystem.species {
+		x[specie.index] = specie.population
+	}
+	return x
+}
+
+// WriteDietCSV() writes the diet composition of the switching predators at every time point to a CSV file,
+// with one column per predator-prey link and the rows numbered with their generation like WriteSampledCSV().
+func WriteDietCSV(timePoints []*Ecosystem, sampleEvery int, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	species := timePoints[0].species
+	header := []string{"Generation"}
+	for _, link := range DietLinks(timePoints[0].switching) {
+		header = append(header, dietLabel(link, species))
+	}
+	if err := writer.Write(header); err != nil {
+		fmt.Println("Error writing header:", err)
+		return
+	}
+
+	for k, ecosystem := range timePoints {
+		row := []string{strconv.Itoa(k * sampleEvery)}
+		for _, share := range DietComposition(ecosystem, timePointPopulations(ecosystem)) {
+			row = append(row, strconv.FormatFloat(share, 'f', -1, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			fmt.Println("Error writing row:", err)
+			return
+		}
+	}
+}
+
+// DrawDiet() takes the time points of a run with prey switching and the time between them,
+// and returns a Plot of the diet share of every predator-prey link over time.
+func DrawDiet(timePoints []*Ecosystem, time float64) *Plot {
+	links := DietLinks(timePoints[0].switching)
+	species := timePoints[0].species
+	end := time * float64(len(timePoints)-1)
+
+	plot := NewPlot(600, 300, 0, end, 0, 1, len(links))
+	previous := DietComposition(timePoints[0], timePointPopulations(timePoints[0]))
+	for k := 1; k < len(timePoints); k++ {
+		shares := DietComposition(timePoints[k], timePointPopulations(timePoints[k]))
+		for l := range links {
+			if !math.IsNaN(previous[l]) && !math.IsNaN(shares[l]) {
+				PlotLine(plot, time*float64(k-1), previous[l], time*float64(k), shares[l], CategoryColor(l))
+			}
+		}
+		previous = shares
+	}
+
+	labels := make([]string, len(links))
+	colors := make([]color.Color, len(links))
+	for l, link := range links {
+		labels[l], colors[l] = dietLabel(link, species), CategoryColor(l)
+	}
+	DrawAxes(plot, "Diet composition", "Time", "Share of consumption")
+	DrawPlotLegend(plot, labels, colors)
+
+	return plot
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+)
+
+// referenceOutputs maps the presets with a stored reference trajectory to the name of its CSV file in the output folder.
+// The references were written by the command line simulation with the default settings.
+var referenceOutputs = map[string]string{
+	"paper":          "data_paper.csv",
+	"stable":         "data_stable_equilibrium.csv",
+	"limit-cycle":    "data_limit_cycle.csv",
+	"extinction-one": "data_extinction_of_one_species.csv",
+}
+
+// Tolerance holds the absolute and relative error allowed between a simulated and a reference population:
+// they match if |simulated - reference| <= absolute + relative·|reference|.
+type Tolerance struct {
+	absolute float64
+	relative float64
+}
+
+// VerificationResult holds the comparison of a simulated trajectory with its reference.
+type VerificationResult struct {
+	preset           string
+	species          []string
+	maxAbsError      []float64 // largest absolute error of every species
+	maxRelError      []float64 // largest error of every species relative to the reference population
+	firstDivergence  int       // first generation out of tolerance, or -1 if the whole trajectory matches
+	divergingSpecies int       // species out of tolerance at the first divergence
+	numGens          int
+}
+
+// WithinTolerance() returns true if a simulated population matches a reference population within a Tolerance.
+func WithinTolerance(tolerance Tolerance, simulated, reference float64) bool {
+	return math.Abs(simulated-reference) <= tolerance.absolute+tolerance.relative*math.Abs(reference)
+}
+
+// CompareTrajectories() takes the simulated time points of one generation each, a reference TimeSeries with one row
+// per generation and a Tolerance. It returns the per-species maximum errors and the first generation at which
+// a population is out of tolerance. The trajectories are compared over the generations they both cover.
+func CompareTrajectories(timePoints []*Ecosystem, reference TimeSeries, tolerance Tolerance) VerificationResult {
+	n := len(reference.names)
+	if len(timePoints[0].species) != n {
+		panic(fmt.Sprintf("Error: the simulation has %d species, but the reference has %d.", len(timePoints[0].species), n))
+	}
+
+	result := VerificationResult{
+		species:          reference.names,
+		maxAbsError:      make([]float64, n),
+		maxRelError:      make([]float64, n),
+		firstDivergence:  -1,
+		divergingSpecies: -1,
+		numGens:          min(len(timePoints), len(reference.data)) - 1,
+	}
+
+	for generation := 0; generation <= result.numGens; generation++ {
+		for _, specie := range timePoints[generation].species {
+			i := specie.index
+			simulated, expected := specie.population, reference.data[generation][i]
+
+			absError := math.Abs(simulated - expected)
+			result.maxAbsError[i] = math.Max(result.maxAbsError[i], absError)
+			if expected != 0 {
+				result.maxRelError[i] = math.Max(result.maxRelError[i], absError/math.Abs(expected))
+			} else if absError > 0 {
+				result.maxRelError[i] = math.Inf(1)
+			}
+
+			// NaN populations never match
+			if result.firstDivergence < 0 && !WithinTolerance(tolerance, simulated, expected) {
+				result.firstDivergence = generation
+				result.divergingSpecies = i
+			}
+		}
+	}
+
+	return result
+}
+
+// VerifyPreset() takes the name of a preset with a reference output, the folder of the references and a Tolerance.
+// It reruns the preset for as many generations as the reference has and compares both trajectories.
+func VerifyPreset(name, folder string, tolerance Tolerance) VerificationResult {
+	filename, ok := referenceOutputs[name]
+	if !ok {
+		panic("Error: no reference output for preset " + name + ".")
+	}
+	scenario, ok := presets[name]
+	if !ok {
+		panic("Error: unknown preset " + name + ".")
+	}
+
+	reference := ReadTimeSeriesCSV(folder+"/"+filename, 1)
+	settings := ScenarioSettings(scenario)
+	settings.numGens = len(reference.data) - 1
+	settings.sampleEvery = 1
+
+	result := CompareTrajectories(SimulateWithSettings(BuildEcosystem(scenario), settings), reference, tolerance)
+	result.preset = name
+	return result
+}
+
+// PrintVerification() prints the per-species maximum errors of a VerificationResult and its first divergence.
+func PrintVerification(result VerificationResult, time float64) {
+	status := "PASS"
+	if result.firstDivergence >= 0 {
+		status = "FAIL"
+	}
+	fmt.Printf("%s: %s over %d generations\n", result.preset, status, result.numGens)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "  Species\tMax abs error\tMax rel error")
+	for i, name := range result.species {
+		fmt.Fprintf(writer, "  %s\t%.3g\t%.3g\n", name, result.maxAbsError[i], result.maxRelError[i])
+	}
+	writer.Flush()
+
+	if result.firstDivergence >= 0 {
+		fmt.Printf("  First divergence at generation %d (time %g) in %s\n", result.firstDivergence,
+			float64(result.firstDivergence)*time, result.species[result.divergingSpecies])
+	}
+}
+
+// VerifyCommand reruns presets and compares their trajectories with the reference outputs stored in the output folder,
+// so that changes to the integrator can be validated. It takes the names of the presets to verify (default all presets
+// with a reference), prints the per-species maximum errors and the first divergence, and exits with status 1 on a failure.
+func VerifyCommand(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	absolute := flags.Float64("abs", 1e-9, "absolute tolerance")
+	relative := flags.Float64("rel", 1e-6, "relative tolerance")
+	folder := flags.String("references", "./output", "folder of the reference outputs")
+	flags.Parse(args)
+
+	names := flags.Args()
+	if len(names) == 0 {
+		for _, name := range PresetNames() {
+			if _, ok := referenceOutputs[name]; ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	tolerance := Tolerance{absolute: *absolute, relative: *relative}
+	failures := 0
+	for _, name := range names {
+		result := VerifyPreset(name, *folder, tolerance)
+		PrintVerification(result, ScenarioSettings(presets[name]).time)
+		if result.firstDivergence >= 0 {
+			failures++
+		}
+	}
+
+	fmt.Printf("%d of %d presets match their reference.\n", len(names)-failures, len(names))
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+// The terminal handling in this file (Dashboard, StartDashboard, stty, UpdateDashboard and DrawDashboard) is the same as
+// in LotkaVolterra/LVSimulation/dashboard.go
+// The two programs are separate Go modules that share no package, so a fix to one must be copied to the other
+// Only the live views differ: Sparkline here takes the range of the allele frequencies, the LV one scales every species to its own range
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Settings of the terminal dashboard
+const (
+	dashboardWidth   = 60                     // characters of the progress bar and of the sparklines
+	dashboardRefresh = 200 * time.Millisecond // time between two redraws
+)
+
+// sparkLevels are the characters of a sparkline, from the lowest to the highest value
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Dashboard is a live view of a running ensemble in the terminal, with the keys that pause, resume and abort it
+type Dashboard struct {
+	title       string
+	total       int //Number of generations of the run
+	start       time.Time
+	pausedSince time.Time     //Zero while running
+	pausedFor   time.Duration //Time spent paused, left out of the ETA
+	lastDraw    time.Time
+	keys        chan byte
+	restore     func() //Restores the terminal settings, nil if they were not changed
+}
+
+// StartDashboard takes in a title and the number of generations of a run
+// It puts the terminal in cbreak mode so that single keys are read without Enter, and returns a Dashboard
+// If the input is not a terminal, keys are still read from it but need Enter
+func StartDashboard(title string, total int) *Dashboard {
+	dashboard := &Dashboard{
+		title: title,
+		total: total,
+		start: time.Now(),
+		keys:  make(chan byte, 16),
+	}
+
+	saved, err := stty("-g")
+	if err == nil {
+		if _, err := stty("cbreak", "-echo"); err == nil {
+			dashboard.restore = func() { stty(strings.TrimSpace(saved)) }
+		}
+	}
+
+	//The reader stays blocked on the input when the run ends, the program ends soon after anyway
+	go func() {
+		buffer := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buffer)
+			if err != nil {
+				return
+			}
+			if n == 1 {
+				dashboard.keys <- buffer[0]
+			}
+		}
+	}()
+
+	fmt.Print("\033[?25l") //Hide the cursor
+	return dashboard
+}
+
+// stty runs stty on the terminal of the standard input with the given arguments
+// It returns the output of stty
+func stty(args ...string) (string, error) {
+	command := exec.Command("stty", args...)
+	command.Stdin = os.Stdin
+	output, err := command.Output()
+	return string(output), err
+}
+
+// StopDashboard restores the terminal settings changed by StartDashboard
+func StopDashboard(dashboard *Dashboard) {
+	if dashboard.restore != nil {
+		dashboard.restore()
+	}
+	fmt.Print("\033[?25h") //Show the cursor
+}
+
+// UpdateDashboard takes in a Dashboard, the number of generations done and a function returning the lines of the live view
+// At most every dashboardRefresh it handles the keys pressed and redraws the view:
+// p (or space) pauses the run until r or p is pressed, and q aborts it
+// It returns false if the run was aborted
+func UpdateDashboard(dashboard *Dashboard, step int, view func() []string) bool {
+	if time.Since(dashboard.lastDraw) < dashboardRefresh && step < dashboard.total {
+		return true
+	}
+
+	for {
+		select {
+		case key := <-dashboard.keys:
+			switch key {
+			case 'p', 'P', ' ':
+				if dashboard.pausedSince.IsZero() {
+					dashboard.pausedSince = time.Now()
+				} else {
+					ResumeDashboard(dashboard)
+				}
+			case 'r', 'R':
+				ResumeDashboard(dashboard)
+			case 'q', 'Q':
+				ResumeDashboard(dashboard)
+				DrawDashboard(dashboard, step, view(), "Aborted")
+				return false
+			}
+			continue
+		default:
+		}
+
+		if dashboard.pausedSince.IsZero() {
+			DrawDashboard(dashboard, step, view(), "Running")
+			return true
+		}
+
+		//Wait for a key while paused
+		DrawDashboard(dashboard, step, view(), "Paused")
+		time.Sleep(dashboardRefresh)
+	}
+}
+
+// ResumeDashboard ends the pause of a Dashboard, if it is paused
+func ResumeDashboard(dashboard *Dashboard) {
+	if !dashboard.pausedSince.IsZero() {
+		dashboard.pausedFor += time.Since(dashboard.pausedSince)
+		dashboard.pausedSince = time.Time{}
+	}
+}
+
+// DrawDashboard clears the terminal and draws the title, a progress bar with the elapsed time and ETA,
+// the status of the run with its keys, and the lines of the live view
+func DrawDashboard(dashboard *Dashboard, step int, lines []string, status string) {
+	dashboard.lastDraw = time.Now()
+
+	//The time spent paused counts neither as elapsed nor for the ETA
+	elapsed := time.Since(dashboard.start) - dashboard.pausedFor
+	if !dashboard.pausedSince.IsZero() {
+		elapsed -= time.Since(dashboard.pausedSince)
+	}
+	eta := "?"
+	if step > 0 {
+		eta = (time.Duration(float64(elapsed) / float64(step) * float64(dashboard.total-step))).Round(time.Second).String()
+	}
+
+	fraction := float64(step) / float64(max(1, dashboard.total))
+	filled := int(fraction * dashboardWidth)
+
+	var view strings.Builder
+	view.WriteString("\033[H\033[J")
+	fmt.Fprintln(&view, dashboard.title)
+	fmt.Fprintf(&view, "[%s%s] %5.1f%%  %d/%d\n", strings.Repeat("#", filled), strings.Repeat("-", dashboardWidth-filled), 100*fraction, step, dashboard.total)
+	fmt.Fprintf(&view, "Elapsed %s  ETA %s\n", elapsed.Round(time.Second), eta)
+	fmt.Fprintf(&view, "%s  (p pause, r resume, q abort and save)\n\n", status)
+	for _, line := range lines {
+		fmt.Fprintln(&view, line)
+	}
+	fmt.Print(view.String())
+}
+
+// Sparkline takes in a slice of values and the range they are drawn in
+// It returns a line of one character per value whose height shows the value in the range
+func Sparkline(values []float64, low, high float64) string {
+	line := make([]rune, len(values))
+	for k, v := range values {
+		level := 0
+		if high > low {
+			level = int((v - low) / (high - low) * float64(len(sparkLevels)-1))
+		}
+		line[k] = sparkLevels[max(0, min(level, len(sparkLevels)-1))]
+	}
+	return string(line)
+}
+
+// SimulateRunsWithDashboard takes in the same parameters as SimulateMultipleRuns
+// It simulates all runs side by side one generation at a time, while a dashboard shows the progress,
+// the mean allele frequency over the runs, and how many runs fixed or lost the allele
+// It returns a slice of population generation slices, with the generations simulated so far if the run was aborted
+func SimulateRunsWithDashboard(numRuns, popSize, numGen int, selCo, freqStart float64) [][]*Population {
+
+	runs := make([][]*Population, numRuns)
+	for i := range runs {
+		runs[i] = make([]*Population, 1, numGen)
+		runs[i][0] = InitializePopulation(popSize, selCo, freqStart)
+	}
+
+	//One sparkline column every column generations, so that the sparklines span the whole run when it ends
+	column := max(1, numGen/dashboardWidth)
+	meanFreqs := []float64{freqStart}
+	fixedCounts := []float64{0}
+
+	//Count the runs where the allele is fixed, lost or still segregating at the last generation
+	var meanFreq float64
+	var fixed, lost int
+	countRuns := func() {
+		meanFreq, fixed, lost = 0, 0, 0
+		for _, timePoints := range runs {
+			freq := timePoints[len(timePoints)-1].freq
+			meanFreq += freq / float64(numRuns)
+			if freq >= 1 {
+				fixed++
+			} else if freq <= 0 {
+				lost++
+			}
+		}
+	}
+
+	view := func() []string {
+		return []string{
+			fmt.Sprintf("Mean allele frequency %-*s %.4f", dashboardWidth+1, Sparkline(meanFreqs, 0, 1), meanFreq),
+			fmt.Sprintf("Runs fixed            %-*s %d of %d", dashboardWidth+1, Sparkline(fixedCounts, 0, float64(numRuns)), fixed, numRuns),
+			fmt.Sprintf("Runs lost             %d, segregating %d", lost, numRuns-fixed-lost),
+		}
+	}
+
+	dashboard := StartDashboard(fmt.Sprintf("Wright-Fisher ensemble: %d runs of population size %d", numRuns, popSize), numGen)
+	defer StopDashboard(dashboard)
+
+	countRuns()
+	for gen := 1; gen < numGen; gen++ {
+		for i := range runs {
+			runs[i] = append(runs[i], SimulateOneGeneration(runs[i][gen-1]))
+		}
+
+		countRuns()
+		if gen%column == 0 {
+			meanFreqs = append(meanFreqs, meanFreq)
+			fixedCounts = append(fixedCounts, float64(fixed))
+		}
+
+		//Generation gen is the (gen+1)-th of numGen
+		if !UpdateDashboard(dashboard, gen+1, view) {
+			fmt.Printf("\nRun aborted at generation %d; saving the partial output.\n", gen)
+			return runs
+		}
+	}
+	fmt.Println()
+
+	return runs
+}
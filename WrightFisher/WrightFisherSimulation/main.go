@@ -77,6 +77,9 @@ func main() {
 		panic("Error: negative number given as number of numRuns.")
 	}
 
+	//the optional sixth parameter "dashboard" shows a live dashboard in the terminal during the simulation
+	dashboard := len(os.Args) > 6 && os.Args[6] == "dashboard"
+
 
 	// Print loaded parameters
 	fmt.Println("Population size =", popSize)
@@ -100,7 +103,12 @@ func main() {
 	// Run simulations using SimulateMultipleRuns
 	fmt.Println("Start simulation!")
 	startTime := time.Now()
-	runs := SimulateMultipleRuns(numRuns, popSize, numGen, selCo, freqStart)
+	var runs [][]*Population
+	if dashboard {
+		runs = SimulateRunsWithDashboard(numRuns, popSize, numGen, selCo, freqStart)
+	} else {
+		runs = SimulateMultipleRuns(numRuns, popSize, numGen, selCo, freqStart)
+	}
 	log.Println("Runtime:", time.Since(startTime))
 	fmt.Println("Simulation done, start output data")
 